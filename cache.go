@@ -0,0 +1,303 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheVersion is the version of the cache file format written by SaveCSV.
+//
+// Version 1 files have no header and three fields: name, lat, long.
+// Version 2 files start with comment lines of metadata, like
+//
+//	# holiday-plan cache
+//	# version: 2
+//	# fetched: 2021-03-12T06:07:00Z
+//	# source: https://en.wikipedia.org/wiki/List_of_waterfalls_of_the_United_Kingdom
+//
+// followed by a header row naming the fields, and a row for each Marker.
+const cacheVersion = 2
+
+// cacheFields are the fields in a cache file, in the order they are written.
+var cacheFields = []string{"name", "lat", "long", "kind", "country", "url", "source", "attrs"}
+
+// SaveCSV saves a Markers to a file in the CSV cache format,
+// with a header of metadata about the Markers followed by
+// a row of cacheFields for each Marker. Attrs is encoded as JSON.
+// If the file already exists it is replaced atomically,
+// so it is never left half written.
+// The number of bytes written and an error is returned.
+func (m Markers) SaveCSV(filename string) (int, error) {
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	// once it has been renamed, removing it fails harmlessly
+	defer os.Remove(f.Name())
+
+	n, err := m.writeCSV(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, err
+	}
+	// TempFile makes files which only the owner can read
+	if err := os.Chmod(f.Name(), 0644); err != nil {
+		return n, err
+	}
+	return n, os.Rename(f.Name(), filename)
+}
+
+// writeCSV writes m to w in the format described by SaveCSV.
+func (m Markers) writeCSV(w io.Writer) (int, error) {
+	cw := &countingWriter{w: w}
+
+	header := fmt.Sprintf("# holiday-plan cache\n# version: %d\n", cacheVersion)
+	if !m.Fetched.IsZero() {
+		header += "# fetched: " + m.Fetched.UTC().Format(time.RFC3339) + "\n"
+	}
+	if m.Source != "" {
+		header += "# source: " + m.Source + "\n"
+	}
+	if _, err := io.WriteString(cw, header); err != nil {
+		return cw.n, err
+	}
+
+	csvw := csv.NewWriter(cw)
+	if err := csvw.Write(cacheFields); err != nil {
+		return cw.n, err
+	}
+	for _, mark := range m.Markers {
+		attrs, err := encodeAttrs(mark.Attrs)
+		if err != nil {
+			return cw.n, err
+		}
+		err = csvw.Write([]string{
+			mark.Name,
+			strconv.FormatFloat(mark.Lat, 'f', 6, 64),
+			strconv.FormatFloat(mark.Long, 'f', 6, 64),
+			string(mark.Kind),
+			mark.Country,
+			mark.URL,
+			mark.Source,
+			attrs,
+		})
+		if err != nil {
+			return cw.n, err
+		}
+	}
+	csvw.Flush()
+
+	return cw.n, csvw.Error()
+}
+
+// CSVtoMarkers takes the name of a CSV file and returns a Markers.
+// The CSV may have been produced by Markers.SaveCSV, in which case
+// the metadata in its header is read too.
+// Older caches without a header, with either three fields (name, lat, long)
+// or all of cacheFields, can still be read.
+// Every row is checked, and errors say which line of the file was wrong.
+func CSVtoMarkers(fname string) (Markers, error) {
+	b, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return Markers{}, err
+	}
+	m, err := readCSV(b)
+	if err != nil {
+		return Markers{}, fmt.Errorf("%s:%v", fname, err)
+	}
+	return m, nil
+}
+
+// readCSV reads Markers in the format written by writeCSV, or an older one.
+// Errors start with the line number they are on.
+func readCSV(b []byte) (Markers, error) {
+	var m Markers
+
+	// read the metadata in the comments at the top
+	version := 1
+	line := 0
+	for bytes.HasPrefix(b, []byte("#")) {
+		line++
+		var comment []byte
+		if i := bytes.IndexByte(b, '\n'); i != -1 {
+			comment, b = b[:i], b[i+1:]
+		} else {
+			comment, b = b, nil
+		}
+		kv := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(string(comment), "#")), ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		var err error
+		switch strings.TrimSpace(kv[0]) {
+		case "version":
+			version, err = strconv.Atoi(value)
+			if err == nil && version > cacheVersion {
+				err = fmt.Errorf("cache version %d is newer than this program's (%d)", version, cacheVersion)
+			}
+		case "fetched":
+			m.Fetched, err = time.Parse(time.RFC3339, value)
+		case "source":
+			m.Source = value
+		}
+		if err != nil {
+			return Markers{}, fmt.Errorf("%d: %v", line, err)
+		}
+	}
+
+	r := csv.NewReader(bytes.NewReader(b))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			return Markers{}, fmt.Errorf("%d: %v", line+perr.Line, perr.Err)
+		}
+		return Markers{}, err
+	}
+	// the line each record starts on, after the comments
+	starts := recordLines(b)
+
+	// the columns each of the fields are in
+	columns := make(map[string]int)
+	if version >= 2 {
+		if len(records) == 0 {
+			return Markers{}, fmt.Errorf("%d: missing header row", line+1)
+		}
+		for i, field := range records[0] {
+			columns[field] = i
+		}
+		for _, field := range []string{"name", "lat", "long"} {
+			if _, ok := columns[field]; !ok {
+				return Markers{}, fmt.Errorf("%d: header has no %q field", line+starts[0], field)
+			}
+		}
+		records, starts = records[1:], starts[1:]
+	} else if len(records) > 0 {
+		// headerless files have either the first three or all of the fields
+		n := len(records[0])
+		if n != 3 && n != len(cacheFields) {
+			return Markers{}, fmt.Errorf("%d: %d fields; wanted 3 or %d", line+starts[0], n, len(cacheFields))
+		}
+		for i := 0; i < n; i++ {
+			columns[cacheFields[i]] = i
+		}
+	}
+
+	m.Markers = make([]Marker, len(records))
+	for i, record := range records {
+		if err := m.Markers[i].fromRecord(record, columns); err != nil {
+			return Markers{}, fmt.Errorf("%d: %v", line+starts[i], err)
+		}
+	}
+	return m, nil
+}
+
+// recordLines returns the line, counting from 1, which each record
+// of the CSV in b starts on. Like a csv.Reader, it skips empty lines
+// and lets quoted fields go over more than one line. b must be valid.
+func recordLines(b []byte) []int {
+	var starts []int
+	quoted := false
+	for i, l := range bytes.Split(b, []byte("\n")) {
+		if !quoted && len(bytes.TrimSuffix(l, []byte("\r"))) > 0 {
+			starts = append(starts, i+1)
+		}
+		// a doubled quote in a quoted field changes nothing
+		if bytes.Count(l, []byte(`"`))%2 == 1 {
+			quoted = !quoted
+		}
+	}
+	return starts
+}
+
+// fromRecord fills in mark from a row of a cache file,
+// where columns gives the column each of the fields is in.
+func (mark *Marker) fromRecord(record []string, columns map[string]int) error {
+	if len(record) != len(columns) {
+		return fmt.Errorf("%d fields; wanted %d", len(record), len(columns))
+	}
+	field := func(name string) string {
+		if i, ok := columns[name]; ok {
+			return record[i]
+		}
+		return ""
+	}
+
+	var err error
+	mark.Name = field("name")
+	if mark.Name == "" {
+		return errors.New("empty name")
+	}
+	if mark.Lat, err = strconv.ParseFloat(field("lat"), 64); err != nil {
+		return fmt.Errorf("lat: %v", err)
+	}
+	if mark.Long, err = strconv.ParseFloat(field("long"), 64); err != nil {
+		return fmt.Errorf("long: %v", err)
+	}
+	if math.Abs(mark.Lat) > 90 || math.Abs(mark.Long) > 180 {
+		return fmt.Errorf("location %f,%f out of range", mark.Lat, mark.Long)
+	}
+	mark.Kind = Kind(field("kind"))
+	mark.Country = field("country")
+	mark.URL = field("url")
+	mark.Source = field("source")
+	if mark.Attrs, err = decodeAttrs(field("attrs")); err != nil {
+		return fmt.Errorf("attrs: %v", err)
+	}
+	return nil
+}
+
+// encodeAttrs encodes Marker.Attrs as JSON for storing in a cache,
+// or as an empty string if there are none.
+func encodeAttrs(attrs map[string]string) (string, error) {
+	if len(attrs) == 0 {
+		return "", nil
+	}
+	b, err := json.Marshal(attrs)
+	return string(b), err
+}
+
+// decodeAttrs is the reverse of encodeAttrs.
+func decodeAttrs(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var attrs map[string]string
+	err := json.Unmarshal([]byte(s), &attrs)
+	return attrs, err
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
@@ -0,0 +1,93 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	m := Markers{
+		Markers: []Marker{{
+			Name:    "Janet's Foss, \"the\" waterfall",
+			Lat:     54.06,
+			Long:    -2.13,
+			Kind:    KindWaterfall,
+			Country: "England",
+			URL:     "https://en.wikipedia.org/wiki/Janet%27s_Foss",
+			Source:  "https://en.wikipedia.org/wiki/List_of_waterfalls_of_the_United_Kingdom",
+			Attrs:   map[string]string{"river": "Gordale Beck"},
+		}, {
+			Name: "Edale",
+			Lat:  53.376148,
+			Long: -1.791024,
+			Kind: KindHostel,
+		}},
+		Source:  "hostels.xml",
+		Fetched: time.Date(2021, 3, 12, 6, 7, 0, 0, time.UTC),
+	}
+	fname := filepath.Join(t.TempDir(), "cache.csv")
+	// an existing cache is replaced
+	if err := ioutil.WriteFile(fname, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.SaveCSV(fname); err != nil {
+		t.Fatal(err)
+	}
+	got, err := CSVtoMarkers(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("CSVtoMarkers = %v; wanted %v", got, m)
+	}
+}
+
+func TestCSVtoMarkersOldFormat(t *testing.T) {
+	got, err := CSVtoMarkers("hostels_cache.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Marker{Name: "Alstonefield", Lat: 53.099043, Long: -1.798700}
+	if len(got.Markers) == 0 || !reflect.DeepEqual(got.Markers[0], want) {
+		t.Errorf("first marker = %v; wanted %v", got.Markers[0], want)
+	}
+}
+
+func TestReadCSVErrors(t *testing.T) {
+	header := "# holiday-plan cache\n# version: 2\nname,lat,long,kind\n"
+	tests := []struct {
+		name, csv, wantErr string
+	}{
+		{"bad lat", header + "a,1,2,hostel\nb,x,2,hostel\n", "5: lat: "},
+		{"too few fields", header + "a,1,2\n", "4: 3 fields; wanted 4"},
+		{"out of range", header + "a,1,2,hostel\nb,1,200,hostel\n", "5: location"},
+		{"no name", header + ",1,2,hostel\n", "4: empty name"},
+		{"missing header field", "# version: 2\nname,lat\n", "2: header has no \"long\" field"},
+		{"newer version", "# version: 3\n", "1: cache version 3"},
+		{"old format", "\"a\",1,2\n\"b\",1\n", "2: 2 fields; wanted 3"},
+		{"bad quotes", header + "\"a\"b\",1,2,hostel\n", "4: "},
+		{"after a blank line", header + "a,1,2,hostel\n\nb,x,2,hostel\n", "6: lat: "},
+		{"after a quoted newline", header + "\"a\nb\",1,2,hostel\nc,1,200,hostel\n", "6: location"},
+		{"header after a blank line", "# version: 2\n\nname,lat\n", "3: header has no \"long\" field"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readCSV([]byte(tt.csv))
+			if err == nil {
+				t.Fatalf("readCSV succeeded; wanted error %q", tt.wantErr)
+			}
+			if !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("readCSV error = %q; wanted it to start with %q", err, tt.wantErr)
+			}
+		})
+	}
+}
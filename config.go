@@ -0,0 +1,251 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Config is the contents of a -config file, which can be used instead
+// of most of the flags. Settings left out of the file are left as the
+// flags have them, and flags given on the command line override the file.
+type Config struct {
+	Datasets map[string]DatasetConfig `json:"datasets"`
+	Match    MatchConfig              `json:"match"`
+	Outputs  OutputsConfig            `json:"outputs"`
+	// HTTPCache is the directory downloaded pages are kept in.
+	HTTPCache string `json:"httpCache"`
+}
+
+// DatasetConfig describes one of the datasets: hostels, waterfalls,
+// scotlands or scothostels.
+type DatasetConfig struct {
+	// Sources replace the ones the flags would load the dataset from.
+	Sources []SourceConfig `json:"sources"`
+	Cache   string         `json:"cache"`
+	Style
+}
+
+// Style is how a dataset's Markers are shown on the map page.
+type Style struct {
+	// Color is a html colour, such as "#550000".
+	Color string `json:"color"`
+	// Scale is the size of the markers; 1 is Mapbox's usual size.
+	Scale float64 `json:"scale"`
+	// Link is a URL for Markers which haven't got one,
+	// with {name} replaced by the Marker's Name.
+	Link string `json:"link"`
+}
+
+// MatchConfig holds the settings for matching and filtering Markers.
+type MatchConfig struct {
+	K            *int     `json:"k"`
+	Radius       *float64 `json:"radius"`
+	HostelRadius *float64 `json:"hostelRadius"`
+	Distance     string   `json:"distance"`
+	Metric       string   `json:"metric"`
+	OSM          string   `json:"osm"`
+	BBox         string   `json:"bbox"`
+	Near         string   `json:"near"`
+	Region       string   `json:"region"`
+	ValidRegion  string   `json:"validRegion"`
+}
+
+// OutputsConfig holds what to write, and where.
+type OutputsConfig struct {
+	PagesDir    string   `json:"pagesDir"`
+	MapPage     *bool    `json:"mappage"`
+	Static      *bool    `json:"static"`
+	Export      []string `json:"export"`
+	ExportDir   string   `json:"exportDir"`
+	GPX         string   `json:"gpx"`
+	MergeReport string   `json:"mergeReport"`
+}
+
+// defaultStyles are the Styles of the datasets unless a Config changes them.
+var defaultStyles = map[string]Style{
+	"hostels":     {Color: hostelColor, Scale: 0.3},
+	"waterfalls":  {Color: waterfallColor, Scale: 0.8},
+	"scotlands":   {Color: scotlandColor, Scale: 0.4},
+	"scothostels": {Color: hostelColor, Scale: 0.3},
+}
+
+// cacheFlags are the flags with the cache file of each dataset.
+var cacheFlags = map[string]string{
+	"hostels":     "hostelCache",
+	"waterfalls":  "waterfallCache",
+	"scotlands":   "scotlandCache",
+	"scothostels": "scotHostelCache",
+}
+
+// sourceFlags are the flags which choose where each dataset is loaded
+// from. If any are given, they are used instead of a Config's Sources.
+var sourceFlags = map[string][]string{
+	"hostels":    {"hostelFile", "hostelFolders", "niHostelFile"},
+	"waterfalls": {"waterfallFile", "waterfallsURL"},
+}
+
+// ReadConfig reads a Config from the JSON in r.
+// Unknown fields and datasets are errors, to catch misspellings.
+func ReadConfig(r io.Reader) (Config, error) {
+	var c Config
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return c, err
+	}
+	for name, ds := range c.Datasets {
+		if _, ok := datasetKinds[name]; !ok {
+			return c, fmt.Errorf("unknown dataset %q", name)
+		}
+		for i := range ds.Sources {
+			if ds.Sources[i].Dataset != "" && ds.Sources[i].Dataset != name {
+				return c, fmt.Errorf("dataset %s: source %d is for dataset %q", name, i, ds.Sources[i].Dataset)
+			}
+			ds.Sources[i].Dataset = name
+		}
+	}
+	return c, nil
+}
+
+// LoadConfig reads a Config from a file using ReadConfig.
+func LoadConfig(filename string) (Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+	c, err := ReadConfig(f)
+	if err != nil {
+		return c, fmt.Errorf("%s: %v", filename, err)
+	}
+	return c, nil
+}
+
+// flagValues returns the values the Config gives flags, by flag name.
+func (c Config) flagValues() map[string]string {
+	v := make(map[string]string)
+	str := func(name, s string) {
+		if s != "" {
+			v[name] = s
+		}
+	}
+	for name, ds := range c.Datasets {
+		str(cacheFlags[name], ds.Cache)
+	}
+	str("httpCache", c.HTTPCache)
+
+	m := c.Match
+	if m.K != nil {
+		v["k"] = strconv.Itoa(*m.K)
+	}
+	if m.Radius != nil {
+		v["radius"] = strconv.FormatFloat(*m.Radius, 'g', -1, 64)
+	}
+	if m.HostelRadius != nil {
+		v["hostelRadius"] = strconv.FormatFloat(*m.HostelRadius, 'g', -1, 64)
+	}
+	str("distance", m.Distance)
+	str("metric", m.Metric)
+	str("osm", m.OSM)
+	str("bbox", m.BBox)
+	str("near", m.Near)
+	str("region", m.Region)
+	str("validRegion", m.ValidRegion)
+
+	o := c.Outputs
+	str("pagesDir", o.PagesDir)
+	if o.MapPage != nil {
+		v["mappage"] = strconv.FormatBool(*o.MapPage)
+	}
+	if o.Static != nil {
+		v["static"] = strconv.FormatBool(*o.Static)
+	}
+	str("export", strings.Join(o.Export, ","))
+	str("exportDir", o.ExportDir)
+	str("gpx", o.GPX)
+	str("mergeReport", o.MergeReport)
+	return v
+}
+
+// apply sets each flag the Config has a value for,
+// unless it is in set because it was given on the command line.
+func (c Config) apply(set map[string]bool, setFlag func(name, value string) error) error {
+	for name, value := range c.flagValues() {
+		if set[name] {
+			continue
+		}
+		if err := setFlag(name, value); err != nil {
+			return fmt.Errorf("config %s: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// sources returns the sources to use, replacing those in flagSources
+// for each dataset the Config has Sources for, unless
+// one of its sourceFlags is in set.
+func (c Config) sources(flagSources []SourceConfig, set map[string]bool) []SourceConfig {
+	replaced := make(map[string]bool)
+	var sources []SourceConfig
+	for _, name := range []string{"hostels", "waterfalls", "scotlands", "scothostels"} {
+		ds := c.Datasets[name]
+		if len(ds.Sources) == 0 {
+			continue
+		}
+		overridden := false
+		for _, f := range sourceFlags[name] {
+			overridden = overridden || set[f]
+		}
+		if !overridden {
+			replaced[name] = true
+			sources = append(sources, ds.Sources...)
+		}
+	}
+	for _, s := range flagSources {
+		if !replaced[s.Dataset] {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
+
+// style returns the Style of the named dataset, from the Config
+// where it has one and otherwise from defaultStyles.
+func (c Config) style(dataset string) Style {
+	s := defaultStyles[dataset]
+	ds := c.Datasets[dataset]
+	if ds.Color != "" {
+		s.Color = ds.Color
+	}
+	if ds.Scale != 0 {
+		s.Scale = ds.Scale
+	}
+	if ds.Link != "" {
+		s.Link = ds.Link
+	}
+	return s
+}
+
+// link gives each Marker in m without a URL one made from the Style's Link.
+// Spaces in names become underscores, as in Wikipedia page names.
+func (s Style) link(m Markers) {
+	if s.Link == "" {
+		return
+	}
+	for i, mark := range m.Markers {
+		if mark.URL == "" {
+			name := url.PathEscape(strings.ReplaceAll(mark.Name, " ", "_"))
+			m.Markers[i].URL = strings.ReplaceAll(s.Link, "{name}", name)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadConfig(t *testing.T) {
+	f, err := os.Open("config.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	c, err := ReadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, ds := range c.Datasets {
+		for _, s := range ds.Sources {
+			if s.Dataset != name {
+				t.Errorf("source %+v of %s has dataset %q", s, name, s.Dataset)
+			}
+			// as main gives them
+			s.Fetcher = newFetcher(nil, 0)
+			if _, err := NewSource(s); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	for _, bad := range []string{
+		`{"datasets": {"castles": {}}}`,
+		`{"match": {"kk": 3}}`,
+		`{"datasets": {"hostels": {"sources": [{"type": "kml", "dataset": "waterfalls"}]}}}`,
+		`{"datasets": `,
+	} {
+		if _, err := ReadConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("read bad config %s", bad)
+		}
+	}
+}
+
+func TestConfigApply(t *testing.T) {
+	c, err := ReadConfig(strings.NewReader(`{
+		"datasets": {"hostels": {"cache": "h.csv"}},
+		"match": {"k": 0, "distance": "vincenty"},
+		"outputs": {"mappage": true, "export": ["geojson", "kml"]}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	err = c.apply(map[string]bool{"distance": true}, func(name, value string) error {
+		got[name] = value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"hostelCache": "h.csv", "k": "0", "mappage": "true", "export": "geojson,kml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flags set %v; wanted %v", got, want)
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	c := Config{Datasets: map[string]DatasetConfig{
+		"waterfalls": {Sources: []SourceConfig{{Type: "geojson", Dataset: "waterfalls", File: "w.geojson"}}},
+	}}
+	flagSources := []SourceConfig{
+		{Type: "kml", Dataset: "hostels", File: "hostels.xml"},
+		{Type: "wikilist", Dataset: "waterfalls", URL: "https://example.com"},
+	}
+	got := c.sources(flagSources, nil)
+	want := []SourceConfig{c.Datasets["waterfalls"].Sources[0], flagSources[0]}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sources = %+v; wanted %+v", got, want)
+	}
+	// a flag for the waterfalls' source overrides the config
+	got = c.sources(flagSources, map[string]bool{"waterfallsURL": true})
+	if !reflect.DeepEqual(got, flagSources) {
+		t.Errorf("sources with -waterfallsURL = %+v; wanted %+v", got, flagSources)
+	}
+}
+
+func TestConfigStyle(t *testing.T) {
+	c := Config{Datasets: map[string]DatasetConfig{
+		"waterfalls": {Style: Style{Color: "#00ff00", Link: "https://en.wikipedia.org/wiki/{name}"}},
+	}}
+	if s := c.style("hostels"); s != defaultStyles["hostels"] {
+		t.Errorf("hostels style = %+v; wanted the default", s)
+	}
+	s := c.style("waterfalls")
+	if s.Color != "#00ff00" || s.Scale != defaultStyles["waterfalls"].Scale {
+		t.Errorf("waterfalls style = %+v", s)
+	}
+
+	m := Markers{Markers: []Marker{
+		{Name: "Aira Force"},
+		{Name: "High Force", URL: "https://example.com/hf"},
+	}}
+	s.link(m)
+	if m.Markers[0].URL != "https://en.wikipedia.org/wiki/Aira_Force" {
+		t.Errorf("linked to %q", m.Markers[0].URL)
+	}
+	if m.Markers[1].URL != "https://example.com/hf" {
+		t.Errorf("replaced URL with %q", m.Markers[1].URL)
+	}
+}
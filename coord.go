@@ -0,0 +1,458 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var errNoLocation = errors.New("No location found")
+
+// template is a wikitext template such as {{coord|54|34|N|2|56|W|display=title}}.
+type template struct {
+	// name is lower case with spaces instead of underscores,
+	// eg "coord" or "infobox waterfall".
+	name string
+	// positional parameters in order, with surrounding whitespace trimmed
+	params []string
+	// named parameters, with lower case keys
+	named map[string]string
+}
+
+// parseTemplates finds all of the templates in the wikitext s,
+// including those nested inside other templates,
+// and returns them in the order that they start in.
+// Templates may span several lines; HTML comments are ignored.
+func parseTemplates(s string) []template {
+	s = stripComments(s)
+
+	type span struct{ start, end int }
+	var spans []span
+	var open []int
+	for i := 0; i < len(s)-1; i++ {
+		switch s[i : i+2] {
+		case "{{":
+			open = append(open, i+2)
+			i++
+		case "}}":
+			if len(open) == 0 {
+				continue
+			}
+			spans = append(spans, span{open[len(open)-1], i})
+			open = open[:len(open)-1]
+			i++
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	templates := make([]template, len(spans))
+	for i, sp := range spans {
+		templates[i] = newTemplate(s[sp.start:sp.end])
+	}
+	return templates
+}
+
+// newTemplate parses the text between the braces of a template.
+func newTemplate(body string) template {
+	parts := splitTopLevel(body)
+	t := template{
+		name:  strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(parts[0], "_", " ")), " ")),
+		named: make(map[string]string),
+	}
+	for _, p := range parts[1:] {
+		if eq := indexTopLevel(p, '='); eq != -1 {
+			key := strings.ToLower(strings.TrimSpace(p[:eq]))
+			t.named[key] = strings.TrimSpace(p[eq+1:])
+			continue
+		}
+		t.params = append(t.params, strings.TrimSpace(p))
+	}
+	return t
+}
+
+// splitTopLevel splits s at each "|" which is not inside
+// a nested template or link.
+func splitTopLevel(s string) []string {
+	var parts []string
+	last := 0
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{") || strings.HasPrefix(s[i:], "[["):
+			depth++
+			i++
+		case strings.HasPrefix(s[i:], "}}") || strings.HasPrefix(s[i:], "]]"):
+			if depth > 0 {
+				depth--
+			}
+			i++
+		case s[i] == '|' && depth == 0:
+			parts = append(parts, s[last:i])
+			last = i + 1
+		}
+	}
+	return append(parts, s[last:])
+}
+
+// indexTopLevel is like strings.IndexByte but ignores c
+// when it is inside a nested template or link.
+func indexTopLevel(s string, c byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "{{") || strings.HasPrefix(s[i:], "[["):
+			depth++
+			i++
+		case strings.HasPrefix(s[i:], "}}") || strings.HasPrefix(s[i:], "]]"):
+			if depth > 0 {
+				depth--
+			}
+			i++
+		case s[i] == c && depth == 0:
+			return i
+		}
+	}
+	return -1
+}
+
+// stripComments removes <!-- HTML comments --> from wikitext.
+func stripComments(s string) string {
+	for {
+		start := strings.Index(s, "<!--")
+		if start == -1 {
+			return s
+		}
+		end := strings.Index(s[start:], "-->")
+		if end == -1 {
+			return s[:start]
+		}
+		s = s[:start] + s[start+end+3:]
+	}
+}
+
+// ParseCoordinates finds the location of the subject of a Wikipedia page
+// from its wikitext and returns it in decimal form.
+// The coordinates shown in the title ({{coord|...|display=title}}) are
+// preferred, then those in an infobox, then the first {{coord}} on the page.
+func ParseCoordinates(wikitext string) (lat, long float64, err error) {
+	templates := parseTemplates(wikitext)
+
+	// the coordinates in the infobox are usually also a {{coord}} template,
+	// nested in the coordinates field, so it is enough to look at the coords
+	// in the order of preference; the old infobox fields are a special case.
+	var inline, infobox []template
+	for _, t := range templates {
+		if strings.HasPrefix(t.name, "infobox") {
+			infobox = append(infobox, t)
+		}
+		if !isCoordTemplate(t.name) {
+			continue
+		}
+		if displaysTitle(t.named["display"]) {
+			if lat, long, err = coordFromTemplate(t); err == nil {
+				return lat, long, nil
+			}
+		}
+		inline = append(inline, t)
+	}
+
+	for _, box := range infobox {
+		for _, key := range []string{"coordinates", "coords"} {
+			if f, ok := box.named[key]; ok {
+				for _, t := range parseTemplates(f) {
+					if isCoordTemplate(t.name) {
+						if lat, long, err = coordFromTemplate(t); err == nil {
+							return lat, long, nil
+						}
+					}
+				}
+			}
+		}
+		if lat, long, err = coordFromInfobox(box); err == nil {
+			return lat, long, nil
+		}
+	}
+
+	for _, t := range inline {
+		if lat, long, err = coordFromTemplate(t); err == nil {
+			return lat, long, nil
+		}
+	}
+	if err == nil {
+		err = errNoLocation
+	}
+	return 0, 0, err
+}
+
+// isCoordTemplate reports whether name is the name of one of the
+// templates used for coordinates: {{coord}} and its old forms {{coor dms}} etc.
+// {{coord missing}} is not one.
+func isCoordTemplate(name string) bool {
+	switch name {
+	case "coord", "coor", "coor d", "coor dm", "coor dms", "coor dec":
+		return true
+	}
+	return false
+}
+
+// coordFromTemplate returns the location in a {{coord}} template.
+// The positional parameters can be in any of these forms:
+//
+//	lat|long                (signed decimal degrees)
+//	d|N|d|W
+//	d|m|N|d|m|W
+//	d|m|s|N|d|m|s|W
+//
+// optionally followed by coordinate parameters like "type:waterfall_region:GB".
+func coordFromTemplate(t template) (lat, long float64, err error) {
+	var p []string
+	for _, s := range t.params {
+		// the coordinate parameters come last and always contain a ':'
+		if strings.Contains(s, ":") {
+			break
+		}
+		p = append(p, s)
+	}
+	if len(p) == 0 {
+		return 0, 0, errNoLocation
+	}
+
+	ns := -1
+	for i, s := range p {
+		if isHemisphere(s, "NS") {
+			ns = i
+			break
+		}
+	}
+
+	if ns == -1 {
+		// decimal form
+		if len(p) < 2 {
+			return 0, 0, fmt.Errorf("coord: not enough parameters in %v", p)
+		}
+		if lat, err = strconv.ParseFloat(p[0], 64); err != nil {
+			return 0, 0, err
+		}
+		if long, err = strconv.ParseFloat(p[1], 64); err != nil {
+			return 0, 0, err
+		}
+		return lat, long, checkRange(lat, long)
+	}
+
+	ew := -1
+	for i := ns + 1; i < len(p); i++ {
+		if isHemisphere(p[i], "EW") {
+			ew = i
+			break
+		}
+	}
+	if ew == -1 {
+		return 0, 0, fmt.Errorf("coord: no E or W in %v", p)
+	}
+	if lat, err = dmsPartsToDec(p[:ns]); err != nil {
+		return 0, 0, err
+	}
+	if long, err = dmsPartsToDec(p[ns+1 : ew]); err != nil {
+		return 0, 0, err
+	}
+	if strings.EqualFold(p[ns], "S") {
+		lat = -lat
+	}
+	if strings.EqualFold(p[ew], "W") {
+		long = -long
+	}
+	return lat, long, checkRange(lat, long)
+}
+
+// coordFromInfobox returns the location in the separate degree, minute and
+// second fields used by older infoboxes, eg lat_d, lat_m, lat_s, lat_NS.
+func coordFromInfobox(t template) (lat, long float64, err error) {
+	field := func(prefixes ...string) (parts []string, hemi string) {
+		for _, pre := range prefixes {
+			if _, ok := t.named[pre+"d"]; !ok {
+				continue
+			}
+			for _, suffix := range []string{"d", "m", "s"} {
+				if v := t.named[pre+suffix]; v != "" {
+					parts = append(parts, v)
+				}
+			}
+			hemi = t.named[pre+"ns"] + t.named[pre+"ew"]
+			return
+		}
+		return
+	}
+	latParts, latHemi := field("lat_", "lat")
+	longParts, longHemi := field("long_", "long", "lon_", "lon")
+	if len(latParts) == 0 || len(longParts) == 0 {
+		return 0, 0, errNoLocation
+	}
+	if lat, err = dmsPartsToDec(latParts); err != nil {
+		return 0, 0, err
+	}
+	if long, err = dmsPartsToDec(longParts); err != nil {
+		return 0, 0, err
+	}
+	if strings.EqualFold(latHemi, "S") {
+		lat = -lat
+	}
+	if strings.EqualFold(longHemi, "W") {
+		long = -long
+	}
+	return lat, long, checkRange(lat, long)
+}
+
+// displaysTitle reports whether the display parameter of a {{coord}}
+// puts the coordinates next to the page title.
+func displaysTitle(display string) bool {
+	for _, d := range strings.Split(display, ",") {
+		switch strings.TrimSpace(d) {
+		case "title", "t", "it", "ti":
+			return true
+		}
+	}
+	return false
+}
+
+func isHemisphere(s, hemispheres string) bool {
+	return len(s) == 1 && strings.ContainsAny(strings.ToUpper(s), hemispheres)
+}
+
+// dmsPartsToDec converts one, two or three parts of degrees,
+// minutes and seconds to decimal degrees, checking that they are numbers.
+func dmsPartsToDec(parts []string) (float64, error) {
+	parts = append([]string(nil), parts...)
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, fmt.Errorf("coord: %d parts in %v; wanted 1 to 3", len(parts), parts)
+	}
+	for i, s := range parts {
+		// an empty part, as in {{coord|54|34||N|...}}, is just zero
+		if s == "" {
+			parts[i] = "0"
+			continue
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		if f < 0 || (i > 0 && f >= 60) {
+			return 0, fmt.Errorf("coord: %v out of range in %v", s, parts)
+		}
+	}
+	return DmsToDec(strings.Join(parts, "|")), nil
+}
+
+func checkRange(lat, long float64) error {
+	if lat < -90 || lat > 90 || long < -180 || long > 180 {
+		return fmt.Errorf("coord: %f,%f out of range", lat, long)
+	}
+	return nil
+}
+
+// infoboxFields are the fields of infoboxes like {{Infobox waterfall}}
+// and the Marker.Attrs keys they are saved as. Where several fields
+// are saved as the same key, the first of them here which the infobox
+// has is used, whatever order they are in in the infobox.
+var infoboxFields = []struct{ field, key string }{
+	{"height", "height"},
+	{"watercourse", "river"},
+	{"river", "river"},
+	{"grid_ref", "gridref"},
+	{"gridref", "gridref"},
+	{"os_grid_reference", "gridref"},
+	{"location", "location"},
+	{"number_drops", "drops"},
+}
+
+// InfoboxAttrs returns the useful fields of the first infobox in the
+// wikitext, such as the height and river of a waterfall, as plain text.
+func InfoboxAttrs(wikitext string) map[string]string {
+	for _, t := range parseTemplates(wikitext) {
+		if !strings.HasPrefix(t.name, "infobox") {
+			continue
+		}
+		var attrs map[string]string
+		for _, f := range infoboxFields {
+			v := plainWikiText(t.named[f.field])
+			if v == "" || attrs[f.key] != "" {
+				continue
+			}
+			if attrs == nil {
+				attrs = make(map[string]string)
+			}
+			attrs[f.key] = v
+		}
+		return attrs
+	}
+	return nil
+}
+
+// plainWikiText turns a short piece of wikitext into plain text:
+// links are replaced with the text they display,
+// {{convert|22|m}} becomes "22 m", other templates are removed
+// and so is bold and italic formatting.
+func plainWikiText(s string) string {
+	s = stripComments(s)
+	var b strings.Builder
+	for len(s) > 0 {
+		switch {
+		case strings.HasPrefix(s, "[["):
+			end := strings.Index(s, "]]")
+			if end == -1 {
+				b.WriteString(s)
+				s = ""
+				continue
+			}
+			link := s[2:end]
+			if i := strings.LastIndex(link, "|"); i != -1 {
+				link = link[i+1:]
+			}
+			b.WriteString(link)
+			s = s[end+2:]
+		case strings.HasPrefix(s, "{{"):
+			end := matchingBraces(s)
+			t := newTemplate(s[2:end])
+			if t.name == "convert" && len(t.params) >= 2 {
+				b.WriteString(t.params[0] + " " + t.params[1])
+			}
+			s = s[end:]
+			if strings.HasPrefix(s, "}}") {
+				s = s[2:]
+			}
+		default:
+			b.WriteByte(s[0])
+			s = s[1:]
+		}
+	}
+	// remove bold and italic quotes
+	plain := strings.ReplaceAll(b.String(), "'''", "")
+	plain = strings.ReplaceAll(plain, "''", "")
+	return strings.Join(strings.Fields(plain), " ")
+}
+
+// matchingBraces returns the index of the "}}" which closes
+// the template that s starts with, or len(s) if it is not closed.
+func matchingBraces(s string) int {
+	depth := 0
+	for i := 0; i < len(s)-1; i++ {
+		switch s[i : i+2] {
+		case "{{":
+			depth++
+			i++
+		case "}}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+			i++
+		}
+	}
+	return len(s)
+}
@@ -0,0 +1,247 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestParseCoordinates(t *testing.T) {
+	tests := []struct {
+		name     string
+		wikitext string
+		lat      float64
+		long     float64
+		wantErr  bool
+	}{{
+		name: "Aira Force infobox",
+		wikitext: `{{Use British English|date=March 2013}}
+{{Infobox waterfall
+| name = Aira Force
+| image = Aira Force, Cumbria.jpg
+| location = [[Lake District]], [[Cumbria]], England
+| coordinates = {{coord|54|34|34.7|N|2|55|51.3|W|region:GB-CMA_type:landmark|display=inline,title}}
+| type = Cascade
+| height = {{convert|22|m|ft}}
+| watercourse = [[Aira Beck]]
+}}
+'''Aira Force''' is a [[waterfall]] in the [[Lake District]].`,
+		lat:  54 + 34.0/60 + 34.7/3600,
+		long: -(2 + 55.0/60 + 51.3/3600),
+	}, {
+		name:     "decimal with display=title",
+		wikitext: "'''High Force''' is a waterfall on the [[River Tees]].\n{{coord|54.6503|-2.1856|type:landmark_region:GB|display=title}}",
+		lat:      54.6503,
+		long:     -2.1856,
+	}, {
+		name:     "decimal with nothing after",
+		wikitext: "{{coord|54.65|-2.18}}",
+		lat:      54.65,
+		long:     -2.18,
+	}, {
+		name:     "capital C and space before pipe",
+		wikitext: "{{Coord |53.1339|-3.7964|display=title}}",
+		lat:      53.1339,
+		long:     -3.7964,
+	}, {
+		name:     "arbitrary whitespace",
+		wikitext: "{{  coord  |  56 | 46 |N| 4 |  58 | W |  display = title  }}",
+		lat:      56 + 46.0/60,
+		long:     -(4 + 58.0/60),
+	}, {
+		name: "template over several lines",
+		wikitext: `{{coord
+ | 55 | 08 | 40 | N
+ | 3 | 26 | 28 | W
+ | region:GB-DGY_type:waterfall
+ | display = inline,title
+}}`,
+		lat:  55 + 8.0/60 + 40.0/3600,
+		long: -(3 + 26.0/60 + 28.0/3600),
+	}, {
+		name:     "degrees and hemisphere only",
+		wikitext: "{{coord|54.2936|N|1.9822|W|display=title}}",
+		lat:      54.2936,
+		long:     -1.9822,
+	}, {
+		name:     "degrees and decimal minutes",
+		wikitext: "{{coord|52|53.5|N|3|23.25|W|display=title}}",
+		lat:      52 + 53.5/60,
+		long:     -(3 + 23.25/60),
+	}, {
+		name:     "format=dms does not confuse the parameters",
+		wikitext: "{{coord|57.2|-3.6|format=dms|display=title}}",
+		lat:      57.2,
+		long:     -3.6,
+	}, {
+		name:     "named parameters before the coordinates",
+		wikitext: "{{coord|name=Swallow Falls|53|6|N|3|47|W|display=title}}",
+		lat:      53 + 6.0/60,
+		long:     -(3 + 47.0/60),
+	}, {
+		name:     "empty seconds",
+		wikitext: "{{coord|54|34||N|2|56||W|display=title}}",
+		lat:      54 + 34.0/60,
+		long:     -(2 + 56.0/60),
+	}, {
+		name:     "east and south",
+		wikitext: "{{coord|33|51|S|151|12|E|display=title}}",
+		lat:      -(33 + 51.0/60),
+		long:     151 + 12.0/60,
+	}, {
+		name:     "lower case hemispheres",
+		wikitext: "{{coord|55|10|n|6|5|w}}",
+		lat:      55 + 10.0/60,
+		long:     -(6 + 5.0/60),
+	}, {
+		name: "title coords preferred over earlier inline coords",
+		wikitext: `It is {{convert|2|km}} from the car park at {{coord|54.5686|-2.9225}}.
+{{coord|54.5763|-2.9309|display=title}}`,
+		lat:  54.5763,
+		long: -2.9309,
+	}, {
+		name: "infobox coords preferred over earlier inline coords",
+		wikitext: `Nearby is [[Ullswater]] {{coord|54.58|-2.88}}
+{{Infobox waterfall
+| coordinates = {{coord|54.5763|-2.9309}}
+}}`,
+		lat:  54.5763,
+		long: -2.9309,
+	}, {
+		name: "old style infobox fields",
+		wikitext: `{{Infobox Waterfall
+| name = Pistyll Rhaeadr
+| lat_d = 52 | lat_m = 51 | lat_s = 19 | lat_NS = N
+| long_d = 3 | long_m = 22 | long_s = 46 | long_EW = W
+| height = 80 m
+}}`,
+		lat:  52 + 51.0/60 + 19.0/3600,
+		long: -(3 + 22.0/60 + 46.0/3600),
+	}, {
+		name: "infobox settlement style fields",
+		wikitext: `{{Infobox settlement
+|latd=54 |latm=9 |latNS=N
+|longd=2 |longm=28 |longEW=W
+}}`,
+		lat:  54 + 9.0/60,
+		long: -(2 + 28.0/60),
+	}, {
+		name:     "first coords used without title or infobox",
+		wikitext: "* Upper falls {{coord|54.15|-2.47}}\n* Lower falls {{coord|54.14|-2.46}}",
+		lat:      54.15,
+		long:     -2.47,
+	}, {
+		name:     "link with a pipe in the same template",
+		wikitext: "{{coord|55.02|-6.15|name=[[Ess na Larach|Ess-na-Larach]]|display=title}}",
+		lat:      55.02,
+		long:     -6.15,
+	}, {
+		name:     "comments are ignored",
+		wikitext: "<!-- {{coord|1|2|display=title}} -->\n{{coord|54.39|-2.34|display=title}}",
+		lat:      54.39,
+		long:     -2.34,
+	}, {
+		name:     "old coor dms template",
+		wikitext: "{{coor dms|51|48|29|N|3|34|37|W|}}",
+		lat:      51 + 48.0/60 + 29.0/3600,
+		long:     -(3 + 34.0/60 + 37.0/3600),
+	}, {
+		name:     "empty coord template",
+		wikitext: "{{coord}}",
+		wantErr:  true,
+	}, {
+		name:     "coord missing",
+		wikitext: "{{coord missing|England}}",
+		wantErr:  true,
+	}, {
+		name:     "no coords at all",
+		wikitext: "#REDIRECT [[River Fowey]]",
+		wantErr:  true,
+	}, {
+		name:     "out of range latitude",
+		wikitext: "{{coord|95|-2}}",
+		wantErr:  true,
+	}, {
+		name:     "minutes out of range",
+		wikitext: "{{coord|54|75|N|2|0|W}}",
+		wantErr:  true,
+	}, {
+		name:     "no E or W",
+		wikitext: "{{coord|54|34|N|2|56}}",
+		wantErr:  true,
+	}, {
+		name:     "bad title coords fall back to good inline coords",
+		wikitext: "{{coord|fifty-four|-2|display=title}} {{coord|54|-2}}",
+		lat:      54,
+		long:     -2,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lat, long, err := ParseCoordinates(tt.wikitext)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseCoordinates = %f, %f; wanted an error", lat, long)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCoordinates: %v", err)
+			}
+			if math.Abs(lat-tt.lat) > 1e-9 || math.Abs(long-tt.long) > 1e-9 {
+				t.Errorf("ParseCoordinates = %f, %f; wanted %f, %f", lat, long, tt.lat, tt.long)
+			}
+		})
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	got := parseTemplates("{{Infobox waterfall\n| name = A [[B|C]]\n| coordinates = {{coord|1|2}}\n| x }}")
+	if len(got) != 2 {
+		t.Fatalf("got %d templates; wanted 2", len(got))
+	}
+	box, coord := got[0], got[1]
+	if box.name != "infobox waterfall" {
+		t.Errorf("name = %q; wanted %q", box.name, "infobox waterfall")
+	}
+	if box.named["name"] != "A [[B|C]]" {
+		t.Errorf("name field = %q; wanted %q", box.named["name"], "A [[B|C]]")
+	}
+	if box.named["coordinates"] != "{{coord|1|2}}" {
+		t.Errorf("coordinates field = %q; wanted %q", box.named["coordinates"], "{{coord|1|2}}")
+	}
+	if len(box.params) != 1 || box.params[0] != "x" {
+		t.Errorf("params = %q; wanted [x]", box.params)
+	}
+	if coord.name != "coord" || len(coord.params) != 2 {
+		t.Errorf("nested template = %+v; wanted coord with 2 params", coord)
+	}
+}
+
+func TestInfoboxAttrs(t *testing.T) {
+	// watercourse is used before river, and grid_ref before
+	// os_grid_reference, although they come later in the infobox
+	const box = "{{Infobox waterfall\n| name = Thornton Force\n| river = [[River Twiss|Twiss]] (lower)\n" +
+		"| height = {{convert|14|m}}\n| os_grid_reference = SD695753\n| watercourse = [[River Twiss]]\n" +
+		"| grid_ref = SD 695 753\n| gridref = \n}}"
+	want := map[string]string{
+		"river":   "River Twiss",
+		"height":  "14 m",
+		"gridref": "SD 695 753",
+	}
+	// the same every time, as ranging over a map wouldn't be
+	for i := 0; i < 20; i++ {
+		if got := InfoboxAttrs(box); !reflect.DeepEqual(got, want) {
+			t.Fatalf("InfoboxAttrs = %v; wanted %v", got, want)
+		}
+	}
+
+	if got := InfoboxAttrs("{{coord|1|2}} no infobox"); got != nil {
+		t.Errorf("InfoboxAttrs without an infobox = %v; wanted nil", got)
+	}
+}
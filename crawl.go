@@ -0,0 +1,102 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// hostLimiter spaces out requests to each host so that
+// they start at least interval apart.
+// It is safe for concurrent use.
+type hostLimiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next map[string]time.Time
+
+	// now and sleep are the clock and how to wait; tests replace them.
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+func newHostLimiter(interval time.Duration) *hostLimiter {
+	return &hostLimiter{
+		interval: interval,
+		next:     make(map[string]time.Time),
+		now:      time.Now,
+		sleep:    sleepContext,
+	}
+}
+
+// wait blocks until a request to the host of rawurl is allowed,
+// or returns ctx's error if it is done first.
+func (l *hostLimiter) wait(ctx context.Context, rawurl string) error {
+	if l == nil || l.interval <= 0 {
+		return ctx.Err()
+	}
+	var host string
+	if u, err := url.Parse(rawurl); err == nil {
+		host = u.Host
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	return l.sleep(ctx, slot.Sub(now))
+}
+
+// crawlPages gets the location of each of the Wikipedia pages using
+// a pool of workers, and returns the Markers in the same order as pages
+// so the output is the same between runs.
+// Pages without a location are left out.
+func crawlPages(ctx context.Context, f *Fetcher, pages []string, workers int) Markers {
+	if workers < 1 {
+		workers = 1
+	}
+	marks := make([]Marker, len(pages))
+	errs := make([]error, len(pages))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				marks[i], errs[i] = GetLocationFromWikiPage(ctx, f, pages[i])
+			}
+		}()
+	}
+	for i := range pages {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var formatted Markers
+	for i, f := range pages {
+		if errs[i] != nil {
+			if *verbose {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", f, errs[i])
+			}
+			continue
+		}
+		formatted.Markers = append(formatted.Markers, marks[i])
+	}
+	return formatted
+}
@@ -0,0 +1,166 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// wikiServer serves canned wikitext in place of Wikipedia
+// and counts the requests.
+// If api is set, it also answers MediaWiki API queries.
+type wikiServer struct {
+	pages map[string]string
+	api   http.HandlerFunc
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (s *wikiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	s.mu.Unlock()
+
+	if r.URL.Path == "/w/api.php" && s.api != nil {
+		s.api(w, r)
+		return
+	}
+	page, ok := s.pages[strings.TrimPrefix(r.URL.Path, "/wiki/")]
+	if !ok || r.URL.Query().Get("action") != "raw" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(page))
+}
+
+// useWikiServer starts a wikiServer with pages and points wikiPrefix
+// and wikiAPI at it until the end of the test.
+func useWikiServer(t *testing.T, pages map[string]string, api http.HandlerFunc) *wikiServer {
+	ws := &wikiServer{pages: pages, api: api}
+	srv := httptest.NewServer(ws)
+	oldPrefix, oldAPI := wikiPrefix, wikiAPI
+	wikiPrefix = srv.URL + "/wiki/"
+	wikiAPI = srv.URL + "/w/api.php"
+	t.Cleanup(func() {
+		wikiPrefix, wikiAPI = oldPrefix, oldAPI
+		srv.Close()
+	})
+	return ws
+}
+
+func TestCrawlWiki(t *testing.T) {
+	ws := useWikiServer(t, map[string]string{
+		"List": "==List of waterfalls==\n\n" +
+			"===[[England ]]===\n" +
+			"*[[Aira Force]]\n" +
+			"*[[Broada Falls]]\n" +
+			"*[[ Ingleton Falls]]\n" +
+			"*[[Aisgill|Hellgill Force]]\n" +
+			"*[[High Force]]\n" +
+			"\n== See also ==\n",
+		"Aira_Force":                "{{Infobox waterfall\n| height = {{convert|22|m|ft}}\n| watercourse = [[Aira Beck]]\n}}\n{{coord|54.5753|-2.9309|display=title}}\n",
+		"Ingleton_Falls":            "#REDIRECT [[Ingleton Waterfalls Trail]]\n",
+		"Ingleton_Waterfalls_Trail": "{{coord|54|9|N|2|28|W}}\n",
+		"Aisgill":                   "{{coord|54.39|N|2.34|W}}\n",
+		"High_Force":                "{{coord|54.65|-2.18|display=inline,title}}\n",
+	}, nil)
+
+	// the clock stands still, so each request is let through
+	// when its wait would have finished
+	interval := time.Minute
+	start := time.Date(2021, 3, 12, 6, 7, 0, 0, time.UTC)
+	f := newFetcher(nil, interval)
+	var mu sync.Mutex
+	var allowed []time.Time
+	f.limit.now = func() time.Time { return start }
+	f.limit.sleep = func(ctx context.Context, d time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		allowed = append(allowed, start.Add(d))
+		return ctx.Err()
+	}
+	got, err := crawlWiki(context.Background(), f, wikiPrefix+"List", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Marker{
+		{Name: "Aira Force", Lat: 54.5753, Long: -2.9309, URL: wikiPrefix + "Aira_Force",
+			Attrs: map[string]string{"height": "22 m", "river": "Aira Beck"}},
+		{Name: "Ingleton Falls", Lat: 54.15, Long: -2 - 28.0/60, URL: wikiPrefix + "Ingleton_Waterfalls_Trail"},
+		{Name: "Aisgill", Lat: 54.39, Long: -2.34, URL: wikiPrefix + "Aisgill"},
+		{Name: "High Force", Lat: 54.65, Long: -2.18, URL: wikiPrefix + "High_Force"},
+	}
+	for i := range want {
+		want[i].Kind = KindWaterfall
+		want[i].Country = "England"
+		want[i].Source = wikiPrefix + "List"
+	}
+	if len(got.Markers) != len(want) {
+		t.Fatalf("crawlWiki got %d markers %v; wanted %d", len(got.Markers), got.Markers, len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got.Markers[i], want[i]) {
+			t.Errorf("marker %d = %v; wanted %v", i, got.Markers[i], want[i])
+		}
+	}
+
+	// the list page, the failed API query, five waterfall pages
+	// and the page redirected to are all rate limited
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.requests != 8 || len(allowed) != 8 {
+		t.Fatalf("got %d requests, %d let through; wanted 8", ws.requests, len(allowed))
+	}
+	sort.Slice(allowed, func(i, j int) bool { return allowed[i].Before(allowed[j]) })
+	for i := 1; i < len(allowed); i++ {
+		if gap := allowed[i].Sub(allowed[i-1]); gap != interval {
+			t.Errorf("request %d was let through %v after the last; wanted %v", i, gap, interval)
+		}
+	}
+}
+
+func TestParseWaterfallList(t *testing.T) {
+	text, err := ioutil.ReadFile("wiki.x-wiki")
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := parseWaterfallList(strings.Split(string(text), "\n"))
+
+	counts := make(map[string]int)
+	for _, l := range listed {
+		counts[l.country]++
+	}
+	want := map[string]int{
+		"England":          57,
+		"Scotland":         20,
+		"Wales":            41,
+		"Northern Ireland": 2,
+	}
+	for country, n := range want {
+		if counts[country] != n {
+			t.Errorf("got %d waterfalls in %s; wanted %d", counts[country], country, n)
+		}
+	}
+	if len(counts) != len(want) {
+		t.Errorf("got waterfalls in %v; wanted only %v", counts, want)
+	}
+
+	last := listed[len(listed)-1]
+	if last.page != "Ess_na_Crub" || last.country != "Northern Ireland" {
+		t.Errorf("last waterfall = %v; wanted Ess_na_Crub in Northern Ireland", last)
+	}
+}
@@ -0,0 +1,254 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// userAgent identifies us to the websites we get data from,
+// as Wikimedia asks of anything using its sites.
+const userAgent = "holiday-plan/1.0 (https://github.com/aabacchus/holiday-plan)"
+
+// The defaults for a Fetcher.
+const (
+	fetchTimeout    = 30 * time.Second
+	fetchRetries    = 3
+	fetchBackoff    = time.Second
+	fetchMaxBackoff = 30 * time.Second
+	// maxRetryAfter is the longest a server can ask us to wait
+	// before we give up rather than retry.
+	maxRetryAfter = 2 * time.Minute
+)
+
+// StatusError is returned by a Fetcher when a request is answered
+// with a status other than 200 OK or 304 Not Modified.
+type StatusError struct {
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("GET %s: %s", e.URL, e.Status)
+}
+
+// retryable reports whether a request which got the status might
+// work if it is tried again later.
+func retryable(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// cachedResponse is a response a Fetcher can reuse, with what
+// it needs to ask the server if it is still up to date.
+type cachedResponse struct {
+	URL     string
+	Header  http.Header
+	Body    []byte
+	Fetched time.Time
+}
+
+// responseCache keeps responses for a Fetcher by URL.
+type responseCache interface {
+	get(url string) (*cachedResponse, bool)
+	put(r *cachedResponse) error
+}
+
+// memoryCache is a responseCache which lasts as long as the program.
+// It is safe for concurrent use.
+type memoryCache struct {
+	mu sync.Mutex
+	m  map[string]*cachedResponse
+}
+
+func (c *memoryCache) get(url string) (*cachedResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r, ok := c.m[url]
+	return r, ok
+}
+
+func (c *memoryCache) put(r *cachedResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.m == nil {
+		c.m = make(map[string]*cachedResponse)
+	}
+	c.m[r.URL] = r
+	return nil
+}
+
+// Fetcher gets web pages for the Sources. It sets a User-Agent,
+// spaces out requests to each host, retries failed requests,
+// waiting longer each time or as long as the server asks,
+// and revalidates pages it has already got with their ETag or
+// Last-Modified time rather than downloading them again.
+// It is safe for concurrent use.
+type Fetcher struct {
+	Client *http.Client
+	// Retries is how many times a request is tried again
+	// after a network error, 429 Too Many Requests or 5xx status.
+	Retries int
+	// Backoff is how long to wait before the first retry;
+	// it doubles for each retry after that, up to MaxBackoff.
+	Backoff, MaxBackoff time.Duration
+	// TTL is how long a cached page is used without asking
+	// the server if it has changed.
+	TTL time.Duration
+	// Offline makes the Fetcher use only cached pages, however old.
+	Offline bool
+
+	limit *hostLimiter
+	cache responseCache
+	// sleep waits for d or until ctx is done; tests replace it.
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// newFetcher returns a Fetcher which makes requests with transport,
+// or http.DefaultTransport if it is nil, and starts requests to each
+// host at least interval apart.
+func newFetcher(transport http.RoundTripper, interval time.Duration) *Fetcher {
+	return &Fetcher{
+		Client:     &http.Client{Transport: transport, Timeout: fetchTimeout},
+		Retries:    fetchRetries,
+		Backoff:    fetchBackoff,
+		MaxBackoff: fetchMaxBackoff,
+		limit:      newHostLimiter(interval),
+		cache:      &memoryCache{},
+		sleep:      sleepContext,
+	}
+}
+
+// sleepContext waits for d, or returns early with ctx's error.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns the body of the page at url.
+// If the status isn't 200 OK (or 304 Not Modified for a page
+// it has already got) the error is a *StatusError.
+func (f *Fetcher) Get(ctx context.Context, url string) ([]byte, error) {
+	cached, haveCached := f.cache.get(url)
+	if haveCached && (f.Offline || time.Since(cached.Fetched) < f.TTL) {
+		return cached.Body, nil
+	}
+	if f.Offline {
+		return nil, fmt.Errorf("GET %s: not cached, and offline", url)
+	}
+	backoff := f.Backoff
+	for try := 0; ; try++ {
+		if err := f.limit.wait(ctx, url); err != nil {
+			return nil, err
+		}
+		resp, err := f.do(ctx, url, cached)
+		var wait time.Duration
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		case resp.StatusCode == http.StatusNotModified && haveCached:
+			resp.Body.Close()
+			f.keep(&cachedResponse{URL: url, Header: cached.Header, Body: cached.Body, Fetched: time.Now()})
+			return cached.Body, nil
+		case resp.StatusCode == http.StatusOK:
+			body, err := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			f.keep(&cachedResponse{URL: url, Header: resp.Header, Body: body, Fetched: time.Now()})
+			return body, nil
+		default:
+			resp.Body.Close()
+			err = &StatusError{URL: url, StatusCode: resp.StatusCode, Status: resp.Status}
+			if !retryable(resp.StatusCode) {
+				return nil, err
+			}
+			if d, ok := retryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if d > maxRetryAfter {
+					return nil, err
+				}
+				wait = d
+			}
+		}
+
+		if try >= f.Retries {
+			return nil, err
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+			if backoff > f.MaxBackoff {
+				backoff = f.MaxBackoff
+			}
+		}
+		if *verbose {
+			fmt.Fprintf(os.Stderr, "%v; retrying in %v\n", err, wait)
+		}
+		if err := f.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// keep puts r in the cache. Not being able to is only worth a warning.
+func (f *Fetcher) keep(r *cachedResponse) {
+	if err := f.cache.put(r); err != nil {
+		fmt.Fprintf(os.Stderr, "caching %s: %v\n", r.URL, err)
+	}
+}
+
+// do makes one request for url, conditional on cached having changed.
+func (f *Fetcher) do(ctx context.Context, url string, cached *cachedResponse) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lm := cached.Header.Get("Last-Modified"); lm != "" {
+			req.Header.Set("If-Modified-Since", lm)
+		}
+	}
+	return f.Client.Do(req)
+}
+
+// retryAfter parses a Retry-After header, which is either
+// a number of seconds or a date, into how long to wait from now.
+func retryAfter(h string, now time.Time) (time.Duration, bool) {
+	if h == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(h); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(h); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
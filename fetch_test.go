@@ -0,0 +1,166 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is a fake http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// reply makes a response to r with the status, headers and body.
+func reply(r *http.Request, code int, header http.Header, body string) *http.Response {
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}
+}
+
+// testFetcher returns a Fetcher using rt which records how long it waits
+// between retries in waits, instead of waiting.
+func testFetcher(rt roundTripFunc, waits *[]time.Duration) *Fetcher {
+	f := newFetcher(rt, 0)
+	f.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		return ctx.Err()
+	}
+	return f
+}
+
+func TestFetcherRetries(t *testing.T) {
+	var waits []time.Duration
+	tries := 0
+	f := testFetcher(func(r *http.Request) (*http.Response, error) {
+		tries++
+		if r.Header.Get("User-Agent") != userAgent {
+			t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+		}
+		switch tries {
+		case 1:
+			return nil, errors.New("connection reset")
+		case 2:
+			return reply(r, http.StatusServiceUnavailable, nil, ""), nil
+		case 3:
+			return reply(r, http.StatusTooManyRequests, http.Header{"Retry-After": {"7"}}, ""), nil
+		}
+		return reply(r, http.StatusOK, nil, "Aira Force"), nil
+	}, &waits)
+
+	body, err := f.Get(context.Background(), "https://example.com/falls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "Aira Force" {
+		t.Errorf("body = %q", body)
+	}
+	want := []time.Duration{fetchBackoff, 2 * fetchBackoff, 7 * time.Second}
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("waited %v; wanted %v", waits, want)
+	}
+
+	// giving up after Retries
+	waits = nil
+	tries = 0
+	f.Client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		tries++
+		return reply(r, http.StatusBadGateway, nil, ""), nil
+	})
+	_, err = f.Get(context.Background(), "https://example.com/falls")
+	var serr *StatusError
+	if !errors.As(err, &serr) || serr.StatusCode != http.StatusBadGateway {
+		t.Errorf("error = %v; wanted a StatusError for 502", err)
+	}
+	if tries != f.Retries+1 {
+		t.Errorf("tried %d times; wanted %d", tries, f.Retries+1)
+	}
+
+	// not retrying what won't change
+	tries = 0
+	f.Client.Transport = roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		tries++
+		return reply(r, http.StatusNotFound, nil, ""), nil
+	})
+	_, err = f.Get(context.Background(), "https://example.com/missing")
+	if !errors.As(err, &serr) || serr.StatusCode != http.StatusNotFound || tries != 1 {
+		t.Errorf("error = %v after %d tries; wanted a StatusError for 404 after 1", err, tries)
+	}
+}
+
+func TestFetcherRevalidates(t *testing.T) {
+	var waits []time.Duration
+	var conditional []string
+	f := testFetcher(func(r *http.Request) (*http.Response, error) {
+		if etag := r.Header.Get("If-None-Match"); etag != "" {
+			conditional = append(conditional, etag)
+			if etag == `"v1"` {
+				return reply(r, http.StatusNotModified, nil, ""), nil
+			}
+		}
+		return reply(r, http.StatusOK, http.Header{"Etag": {`"v1"`}}, "High Force"), nil
+	}, &waits)
+
+	for i := 0; i < 2; i++ {
+		body, err := f.Get(context.Background(), "https://example.com/high")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "High Force" {
+			t.Errorf("body %d = %q", i, body)
+		}
+	}
+	if !reflect.DeepEqual(conditional, []string{`"v1"`}) {
+		t.Errorf("conditional requests with %v; wanted one with \"v1\"", conditional)
+	}
+}
+
+func TestFetcherCancel(t *testing.T) {
+	f := newFetcher(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return reply(r, http.StatusServiceUnavailable, nil, ""), nil
+	}), 0)
+	f.Backoff = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := f.Get(ctx, "https://example.com/down"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v; wanted the context's", err)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2021, 3, 12, 6, 7, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		h    string
+		want time.Duration
+		ok   bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"Fri, 12 Mar 2021 06:07:30 GMT", 30 * time.Second, true},
+		{"Fri, 12 Mar 2021 06:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"soon", 0, false},
+		{"-5", 0, false},
+	} {
+		got, ok := retryAfter(tt.h, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; wanted %v, %v", tt.h, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+// Package geodesy calculates distances and bearings between
+// points on the Earth, on a sphere or on the WGS84 ellipsoid.
+package geodesy
+
+import (
+	"errors"
+	"math"
+)
+
+// MeanRadius is the mean radius of the Earth in meters,
+// used by the spherical calculations.
+const MeanRadius = 6371.009e3
+
+// The WGS84 ellipsoid.
+const (
+	wgs84A = 6378137.0         // semi-major axis in meters
+	wgs84F = 1 / 298.257223563 // flattening
+	wgs84B = wgs84A * (1 - wgs84F)
+)
+
+// ErrNoConvergence is returned by Vincenty for points
+// which are nearly antipodal.
+var ErrNoConvergence = errors.New("geodesy: Vincenty formula failed to converge")
+
+// Point is a position in decimal degrees.
+type Point struct {
+	Lat, Long float64
+}
+
+func radians(deg float64) float64 { return deg * math.Pi / 180 }
+func degrees(rad float64) float64 { return rad * 180 / math.Pi }
+
+// Haversine returns the great-circle distance in meters between a and b
+// on a sphere of MeanRadius. It is within about 0.5% of the distance
+// on the ellipsoid.
+func Haversine(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLat := lat2 - lat1
+	dLong := radians(b.Long - a.Long)
+	h := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLong/2), 2)
+	return MeanRadius * 2 * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Vincenty returns the distance in meters between a and b along
+// the WGS84 ellipsoid, using Vincenty's inverse formula,
+// which is accurate to within a millimeter.
+// It returns ErrNoConvergence if a and b are nearly antipodal.
+func Vincenty(a, b Point) (float64, error) {
+	L := radians(b.Long - a.Long)
+	U1 := math.Atan((1 - wgs84F) * math.Tan(radians(a.Lat)))
+	U2 := math.Atan((1 - wgs84F) * math.Tan(radians(b.Lat)))
+	sinU1, cosU1 := math.Sincos(U1)
+	sinU2, cosU2 := math.Sincos(U2)
+
+	lambda := L
+	for i := 0; i < 200; i++ {
+		sinLambda, cosLambda := math.Sincos(lambda)
+		sinSigma := math.Hypot(cosU2*sinLambda, cosU1*sinU2-sinU1*cosU2*cosLambda)
+		if sinSigma == 0 {
+			// the same point
+			return 0, nil
+		}
+		cosSigma := sinU1*sinU2 + cosU1*cosU2*cosLambda
+		sigma := math.Atan2(sinSigma, cosSigma)
+		sinAlpha := cosU1 * cosU2 * sinLambda / sinSigma
+		cos2Alpha := 1 - sinAlpha*sinAlpha
+		cos2SigmaM := 0.0
+		if cos2Alpha != 0 {
+			// not on the equator
+			cos2SigmaM = cosSigma - 2*sinU1*sinU2/cos2Alpha
+		}
+		C := wgs84F / 16 * cos2Alpha * (4 + wgs84F*(4-3*cos2Alpha))
+		prev := lambda
+		lambda = L + (1-C)*wgs84F*sinAlpha*
+			(sigma+C*sinSigma*(cos2SigmaM+C*cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)))
+		if math.Abs(lambda-prev) > 1e-12 {
+			continue
+		}
+
+		u2 := cos2Alpha * (wgs84A*wgs84A - wgs84B*wgs84B) / (wgs84B * wgs84B)
+		A := 1 + u2/16384*(4096+u2*(-768+u2*(320-175*u2)))
+		B := u2 / 1024 * (256 + u2*(-128+u2*(74-47*u2)))
+		deltaSigma := B * sinSigma * (cos2SigmaM + B/4*(cosSigma*(-1+2*cos2SigmaM*cos2SigmaM)-
+			B/6*cos2SigmaM*(-3+4*sinSigma*sinSigma)*(-3+4*cos2SigmaM*cos2SigmaM)))
+		return wgs84B * A * (sigma - deltaSigma), nil
+	}
+	return 0, ErrNoConvergence
+}
+
+// InitialBearing returns the bearing in degrees clockwise from north,
+// in [0, 360), to start along the great circle from a to b.
+func InitialBearing(a, b Point) float64 {
+	lat1, lat2 := radians(a.Lat), radians(b.Lat)
+	dLong := radians(b.Long - a.Long)
+	y := math.Sin(dLong) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(dLong)
+	return math.Mod(degrees(math.Atan2(y, x))+360, 360)
+}
+
+// Destination returns the point reached by going distance meters
+// from a along the great circle starting at bearing degrees
+// clockwise from north, on a sphere of MeanRadius.
+func Destination(a Point, bearing, distance float64) Point {
+	lat1, long1 := radians(a.Lat), radians(a.Long)
+	theta := radians(bearing)
+	delta := distance / MeanRadius
+	lat2 := math.Asin(math.Sin(lat1)*math.Cos(delta) + math.Cos(lat1)*math.Sin(delta)*math.Cos(theta))
+	long2 := long1 + math.Atan2(math.Sin(theta)*math.Sin(delta)*math.Cos(lat1),
+		math.Cos(delta)-math.Sin(lat1)*math.Sin(lat2))
+	// normalise to [-180, 180)
+	long := math.Mod(degrees(long2)+540, 360) - 180
+	return Point{Lat: degrees(lat2), Long: long}
+}
+
+// Distance is a function giving the distance in meters between two points.
+type Distance func(a, b Point) float64
+
+// VincentyOrHaversine is Vincenty, but falls back to Haversine
+// for the points Vincenty cannot do.
+func VincentyOrHaversine(a, b Point) float64 {
+	d, err := Vincenty(a, b)
+	if err != nil {
+		return Haversine(a, b)
+	}
+	return d
+}
+
+// Distances are the Distance functions by name,
+// for choosing between them with a flag.
+var Distances = map[string]Distance{
+	"haversine": Haversine,
+	"vincenty":  VincentyOrHaversine,
+}
@@ -0,0 +1,128 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package geodesy
+
+import (
+	"math"
+	"testing"
+)
+
+func dms(d, m, s float64) float64 {
+	if d < 0 {
+		return d - m/60 - s/3600
+	}
+	return d + m/60 + s/3600
+}
+
+var (
+	// the example in Vincenty's paper, from Geoscience Australia
+	flinders  = Point{dms(-37, 57, 3.72030), dms(144, 25, 29.52440)}
+	buninyong = Point{dms(-37, 39, 10.15610), dms(143, 55, 35.38390)}
+
+	london    = Point{51.5074, -0.1278}
+	edinburgh = Point{55.9533, -3.1883}
+)
+
+func TestHaversine(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+		tol  float64
+	}{
+		{"same point", london, london, 0, 1e-9},
+		{"1° of longitude on the equator", Point{0, 0}, Point{0, 1}, MeanRadius * math.Pi / 180, 1e-6},
+		{"pole to pole", Point{90, 0}, Point{-90, 0}, MeanRadius * math.Pi, 1e-6},
+		{"antipodes", Point{10, 20}, Point{-10, -160}, MeanRadius * math.Pi, 1e-6},
+		{"across the antimeridian", Point{0, 179.5}, Point{0, -179.5}, MeanRadius * math.Pi / 180, 1e-6},
+		{"London to Edinburgh", london, edinburgh, 534e3, 1e3},
+		{"Flinders Peak to Buninyong", flinders, buninyong, 54972.271, 0.005 * 54972},
+	}
+	for _, tt := range tests {
+		if got := Haversine(tt.a, tt.b); math.Abs(got-tt.want) > tt.tol {
+			t.Errorf("%s: Haversine = %f; wanted %f", tt.name, got, tt.want)
+		}
+		if got := Haversine(tt.b, tt.a); math.Abs(got-tt.want) > tt.tol {
+			t.Errorf("%s: Haversine reversed = %f; wanted %f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVincenty(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{"same point", flinders, flinders, 0},
+		{"Flinders Peak to Buninyong", flinders, buninyong, 54972.271},
+		// a degree of longitude on the equator is a degree of the semi-major axis
+		{"1° of longitude on the equator", Point{0, 0}, Point{0, 1}, 111319.491},
+		// the length of a meridian from pole to pole
+		{"pole to pole", Point{90, 0}, Point{-90, 0}, 20003931.459},
+		{"equator to pole", Point{0, 0}, Point{90, 0}, 10001965.729},
+	}
+	for _, tt := range tests {
+		got, err := Vincenty(tt.a, tt.b)
+		if err != nil {
+			t.Errorf("%s: Vincenty: %v", tt.name, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 0.001 {
+			t.Errorf("%s: Vincenty = %.4f; wanted %.4f", tt.name, got, tt.want)
+		}
+	}
+
+	nearlyAntipodal := Point{-0.5, -179.7}
+	if d, err := Vincenty(Point{0, 0}, nearlyAntipodal); err != ErrNoConvergence {
+		t.Errorf("Vincenty of nearly antipodal points = %f, %v; wanted ErrNoConvergence", d, err)
+	}
+	if d := VincentyOrHaversine(Point{0, 0}, nearlyAntipodal); d != Haversine(Point{0, 0}, nearlyAntipodal) {
+		t.Errorf("VincentyOrHaversine of nearly antipodal points = %f; wanted the Haversine distance", d)
+	}
+}
+
+func TestInitialBearing(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+		tol  float64
+	}{
+		{"north", Point{0, 0}, Point{1, 0}, 0, 1e-9},
+		{"east", Point{0, 0}, Point{0, 1}, 90, 1e-9},
+		{"south", Point{1, 0}, Point{0, 0}, 180, 1e-9},
+		{"west", Point{0, 1}, Point{0, 0}, 270, 1e-9},
+		{"east across the antimeridian", Point{0, 179.5}, Point{0, -179.5}, 90, 1e-9},
+		// the ellipsoidal bearing is 306°52'05.37"; the spherical one is close
+		{"Flinders Peak to Buninyong", flinders, buninyong, dms(306, 52, 5.37), 0.2},
+	}
+	for _, tt := range tests {
+		if got := InitialBearing(tt.a, tt.b); math.Abs(got-tt.want) > tt.tol {
+			t.Errorf("%s: InitialBearing = %f; wanted %f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDestination(t *testing.T) {
+	// a quarter of the way round the equator
+	got := Destination(Point{0, 0}, 90, MeanRadius*math.Pi/2)
+	if math.Abs(got.Lat) > 1e-9 || math.Abs(got.Long-90) > 1e-9 {
+		t.Errorf("Destination east along the equator = %v; wanted {0 90}", got)
+	}
+	got = Destination(Point{0, 170}, 90, MeanRadius*math.Pi/9)
+	if math.Abs(got.Lat) > 1e-9 || math.Abs(got.Long+170) > 1e-9 {
+		t.Errorf("Destination across the antimeridian = %v; wanted {0 -170}", got)
+	}
+
+	// going back along the bearing and distance between two points
+	for _, p := range [][2]Point{{london, edinburgh}, {flinders, buninyong}, {Point{10, 20}, Point{-30, 100}}} {
+		got := Destination(p[0], InitialBearing(p[0], p[1]), Haversine(p[0], p[1]))
+		if math.Abs(got.Lat-p[1].Lat) > 1e-9 || math.Abs(got.Long-p[1].Long) > 1e-9 {
+			t.Errorf("Destination from %v towards %v = %v", p[0], p[1], got)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// geoJSON is any GeoJSON object: a FeatureCollection, Feature or Geometry.
+// Only the members used by Markers are included.
+// It is used for reading; Markers are written as a geoJSONCollection.
+type geoJSON struct {
+	Type string `json:"type"`
+
+	// FeatureCollection
+	Features []geoJSON `json:"features,omitempty"`
+	// these are foreign members holding Markers.Source and Fetched
+	Source  string `json:"source,omitempty"`
+	Fetched string `json:"fetched,omitempty"`
+
+	// Feature
+	Geometry   *geoJSON               `json:"geometry,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+
+	// Geometry; the structure depends on the type
+	Coordinates json.RawMessage `json:"coordinates,omitempty"`
+	Geometries  []geoJSON       `json:"geometries,omitempty"`
+}
+
+type geoJSONCollection struct {
+	Type     string           `json:"type"`
+	Source   string           `json:"source,omitempty"`
+	Fetched  string           `json:"fetched,omitempty"`
+	Features []geoJSONFeature `json:"features"`
+}
+
+type geoJSONFeature struct {
+	Type       string                 `json:"type"`
+	Geometry   geoJSONPoint           `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// WriteGeoJSON writes m to w as a GeoJSON FeatureCollection of Points.
+// Each Feature has the Marker's Name, Kind, Country, URL and Source
+// as properties, along with each of its Attrs.
+func (m Markers) WriteGeoJSON(w io.Writer) error {
+	fc := geoJSONCollection{
+		Type:     "FeatureCollection",
+		Source:   m.Source,
+		Features: make([]geoJSONFeature, 0, len(m.Markers)),
+	}
+	if !m.Fetched.IsZero() {
+		fc.Fetched = m.Fetched.UTC().Format(time.RFC3339)
+	}
+	for _, mark := range m.Markers {
+		props := make(map[string]interface{})
+		for k, v := range mark.Attrs {
+			props[k] = v
+		}
+		for k, v := range map[string]string{
+			"name":    mark.Name,
+			"kind":    string(mark.Kind),
+			"country": mark.Country,
+			"url":     mark.URL,
+			"source":  mark.Source,
+		} {
+			if v != "" {
+				props[k] = v
+			}
+		}
+		fc.Features = append(fc.Features, geoJSONFeature{
+			Type: "Feature",
+			// GeoJSON positions are longitude first
+			Geometry:   geoJSONPoint{Type: "Point", Coordinates: [2]float64{mark.Long, mark.Lat}},
+			Properties: props,
+		})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(fc)
+}
+
+// ReadGeoJSON reads Markers from the GeoJSON in r, which may be a
+// FeatureCollection, a single Feature or a bare geometry.
+// There is a Marker for each Point (and each point of a MultiPoint);
+// other geometries are skipped.
+// The Marker fields are taken from the Feature's properties,
+// as written by WriteGeoJSON; other properties are put in Attrs.
+// Markers without a kind property are given kind.
+func ReadGeoJSON(r io.Reader, kind Kind) (Markers, error) {
+	var g geoJSON
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return Markers{}, err
+	}
+	m := Markers{Source: g.Source}
+	if g.Fetched != "" {
+		m.Fetched, _ = time.Parse(time.RFC3339, g.Fetched)
+	}
+
+	var features []geoJSON
+	switch g.Type {
+	case "FeatureCollection":
+		features = g.Features
+	case "Feature":
+		features = []geoJSON{g}
+	default:
+		features = []geoJSON{{Type: "Feature", Geometry: &g}}
+	}
+
+	for i, f := range features {
+		if f.Type != "Feature" {
+			return m, fmt.Errorf("feature %d: type %q is not Feature", i, f.Type)
+		}
+		if f.Geometry == nil {
+			continue
+		}
+		points, err := f.Geometry.points()
+		if err != nil {
+			return m, fmt.Errorf("feature %d: %v", i, err)
+		}
+		for _, p := range points {
+			mark := markerFromProperties(f.Properties, kind)
+			mark.Long, mark.Lat = p[0], p[1]
+			if mark.Name == "" {
+				mark.Name = fmt.Sprintf("#%d", i)
+			}
+			m.Markers = append(m.Markers, mark)
+		}
+	}
+	return m, nil
+}
+
+// points returns the positions in a Point or MultiPoint geometry,
+// or in the points of a GeometryCollection.
+func (g *geoJSON) points() ([][]float64, error) {
+	var points [][]float64
+	switch g.Type {
+	case "Point":
+		var p []float64
+		if err := json.Unmarshal(g.Coordinates, &p); err != nil {
+			return nil, err
+		}
+		points = [][]float64{p}
+	case "MultiPoint":
+		if err := json.Unmarshal(g.Coordinates, &points); err != nil {
+			return nil, err
+		}
+	case "GeometryCollection":
+		for i := range g.Geometries {
+			p, err := g.Geometries[i].points()
+			if err != nil {
+				return nil, err
+			}
+			points = append(points, p...)
+		}
+	}
+	for _, p := range points {
+		if len(p) < 2 {
+			return nil, fmt.Errorf("position %v has fewer than 2 coordinates", p)
+		}
+	}
+	return points, nil
+}
+
+// markerFromProperties makes a Marker with the fields and Attrs
+// in the properties of a GeoJSON Feature.
+func markerFromProperties(props map[string]interface{}, kind Kind) Marker {
+	mark := Marker{Kind: kind}
+	for k, v := range props {
+		if v == nil {
+			continue
+		}
+		s, ok := v.(string)
+		if !ok {
+			// numbers, bools and anything else are kept as their JSON
+			b, _ := json.Marshal(v)
+			s = string(b)
+		}
+		switch strings.ToLower(k) {
+		case "name":
+			mark.Name = s
+		case "kind":
+			mark.Kind = Kind(s)
+		case "country":
+			mark.Country = s
+		case "url":
+			mark.URL = s
+		case "source":
+			mark.Source = s
+		default:
+			if mark.Attrs == nil {
+				mark.Attrs = make(map[string]string)
+			}
+			mark.Attrs[k] = s
+		}
+	}
+	return mark
+}
+
+// SaveGeoJSON saves m to the file as GeoJSON, replacing it if it exists.
+func (m Markers) SaveGeoJSON(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := m.WriteGeoJSON(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// GeoJSONtoMarkers reads the Markers in a GeoJSON file using ReadGeoJSON.
+// If the file doesn't say where its Markers came from, their Source is the file.
+func GeoJSONtoMarkers(filename string, kind Kind) (Markers, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Markers{}, err
+	}
+	defer f.Close()
+	m, err := ReadGeoJSON(f, kind)
+	if err != nil {
+		return m, fmt.Errorf("%s: %v", filename, err)
+	}
+	if m.Source == "" {
+		m.Source = filename
+	}
+	for i := range m.Markers {
+		if m.Markers[i].Source == "" {
+			m.Markers[i].Source = m.Source
+		}
+	}
+	return m, nil
+}
+
+// isGeoJSON reports whether filename looks like the name of a GeoJSON file.
+func isGeoJSON(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".geojson", ".json":
+		return true
+	}
+	return false
+}
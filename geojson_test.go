@@ -0,0 +1,103 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGeoJSONRoundTrip(t *testing.T) {
+	m := Markers{
+		Markers: []Marker{{
+			Name:    "Janet's Foss",
+			Lat:     54.06,
+			Long:    -2.13,
+			Kind:    KindWaterfall,
+			Country: "England",
+			URL:     "https://en.wikipedia.org/wiki/Janet%27s_Foss",
+			Source:  "https://en.wikipedia.org/wiki/List_of_waterfalls_of_the_United_Kingdom",
+			Attrs:   map[string]string{"river": "Gordale Beck"},
+		}, {
+			Name: "Edale",
+			Lat:  53.376148,
+			Long: -1.791024,
+			Kind: KindHostel,
+		}},
+		Source:  "hostels.xml",
+		Fetched: time.Date(2021, 3, 12, 6, 7, 0, 0, time.UTC),
+	}
+	var buf bytes.Buffer
+	if err := m.WriteGeoJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	// positions are longitude first
+	if !strings.Contains(buf.String(), "-2.13,\n") {
+		t.Errorf("WriteGeoJSON wrote longitude in the wrong place:\n%s", buf.String())
+	}
+	got, err := ReadGeoJSON(&buf, KindOther)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("ReadGeoJSON = %v; wanted %v", got, m)
+	}
+}
+
+func TestReadGeoJSON(t *testing.T) {
+	const in = `{
+	"type": "FeatureCollection",
+	"features": [
+		{"type": "Feature",
+		 "geometry": {"type": "Point", "coordinates": [-3.7964, 53.1339, 120]},
+		 "properties": {"Name": "Swallow Falls", "height": 42, "river": "Afon Llugwy"}},
+		{"type": "Feature",
+		 "geometry": {"type": "MultiPoint", "coordinates": [[-2.1, 54.6], [-2.2, 54.7]]},
+		 "properties": null},
+		{"type": "Feature",
+		 "geometry": {"type": "LineString", "coordinates": [[-2.1, 54.6], [-2.2, 54.7]]},
+		 "properties": {"name": "a path"}},
+		{"type": "Feature", "geometry": null, "properties": {"name": "nowhere"}}
+	]
+}`
+	got, err := ReadGeoJSON(strings.NewReader(in), KindWaterfall)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Marker{{
+		Name:  "Swallow Falls",
+		Lat:   53.1339,
+		Long:  -3.7964,
+		Kind:  KindWaterfall,
+		Attrs: map[string]string{"height": "42", "river": "Afon Llugwy"},
+	}, {
+		Name: "#1",
+		Lat:  54.6,
+		Long: -2.1,
+		Kind: KindWaterfall,
+	}, {
+		Name: "#1",
+		Lat:  54.7,
+		Long: -2.2,
+		Kind: KindWaterfall,
+	}}
+	if !reflect.DeepEqual(got.Markers, want) {
+		t.Errorf("ReadGeoJSON = %v; wanted %v", got.Markers, want)
+	}
+
+	for _, bad := range []string{
+		`{"type": "Point", "coordinates": [1]}`,
+		`{"type": "FeatureCollection", "features": [{"type": "Point"}]}`,
+		`{"type": "Feature"`,
+	} {
+		if _, err := ReadGeoJSON(strings.NewReader(bad), KindOther); err == nil {
+			t.Errorf("ReadGeoJSON(%s) succeeded; wanted an error", bad)
+		}
+	}
+}
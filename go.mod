@@ -2,4 +2,8 @@ module github.com/aabacchus/holiday-plan
 
 go 1.15
 
-require github.com/the42/cartconvert v1.0.0
+require (
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/the42/cartconvert v1.0.0
+)
@@ -0,0 +1,150 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// gpxNamespace is the XML namespace of GPX 1.1.
+const gpxNamespace = "http://www.topografix.com/GPX/1/1"
+
+// gpx is the root of a GPX 1.1 file, with only the elements we write.
+type gpx struct {
+	XMLName   xml.Name      `xml:"gpx"`
+	Version   string        `xml:"version,attr"`
+	Creator   string        `xml:"creator,attr"`
+	Xmlns     string        `xml:"xmlns,attr"`
+	Metadata  *gpxMetadata  `xml:"metadata"`
+	Waypoints []gpxWaypoint `xml:"wpt"`
+	Routes    []gpxRoute    `xml:"rte"`
+}
+
+type gpxMetadata struct {
+	Name string `xml:"name,omitempty"`
+	Time string `xml:"time,omitempty"`
+}
+
+// gpxWaypoint is a wpt, or an rtept in a route.
+type gpxWaypoint struct {
+	Lat  float64  `xml:"lat,attr"`
+	Lon  float64  `xml:"lon,attr"`
+	Name string   `xml:"name"`
+	Desc string   `xml:"desc,omitempty"`
+	Link *gpxLink `xml:"link"`
+	Type string   `xml:"type,omitempty"`
+}
+
+type gpxLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type gpxRoute struct {
+	Name   string        `xml:"name"`
+	Desc   string        `xml:"desc,omitempty"`
+	Points []gpxWaypoint `xml:"rtept"`
+}
+
+// markerToGPX returns mark as a GPX waypoint,
+// linking to its URL and with its Kind as the type.
+func markerToGPX(mark Marker) gpxWaypoint {
+	wpt := gpxWaypoint{
+		Lat:  mark.Lat,
+		Lon:  mark.Long,
+		Name: mark.Name,
+		Desc: mark.Country,
+		Type: string(mark.Kind),
+	}
+	if mark.URL != "" {
+		wpt.Link = &gpxLink{Href: mark.URL}
+	}
+	return wpt
+}
+
+// newGPXRoute returns a route through the Markers in order.
+func newGPXRoute(name, desc string, route []Marker) gpxRoute {
+	r := gpxRoute{Name: name, Desc: desc}
+	for _, mark := range route {
+		r.Points = append(r.Points, markerToGPX(mark))
+	}
+	return r
+}
+
+// matchRoute returns the Node of match followed by its Childs,
+// nearest to the Node first as measured by dist.
+func matchRoute(match Match, dist geodesy.Distance) []Marker {
+	childs := append([]Marker(nil), match.Childs...)
+	sort.SliceStable(childs, func(i, j int) bool {
+		return distanceBn(dist, match.Node, childs[i]) < distanceBn(dist, match.Node, childs[j])
+	})
+	return append([]Marker{match.Node}, childs...)
+}
+
+// WriteGPX writes a GPX file to w with a waypoint for each of the waypoints
+// and, for each Match, a route from its Node (a hostel) to its Childs,
+// nearest first as measured by dist.
+func WriteGPX(w io.Writer, waypoints Markers, matches []Match, dist geodesy.Distance) error {
+	var routes []gpxRoute
+	for _, match := range matches {
+		desc := fmt.Sprintf("From %s to the waterfalls closest to it", match.Node.Name)
+		routes = append(routes, newGPXRoute(match.Node.Name, desc, matchRoute(match, dist)))
+	}
+	return writeGPX(w, waypoints, routes)
+}
+
+// writeGPX writes a GPX file to w with a waypoint for each of the waypoints
+// and the routes.
+func writeGPX(w io.Writer, waypoints Markers, routes []gpxRoute) error {
+	g := gpx{
+		Version: "1.1",
+		Creator: "holiday-plan",
+		Xmlns:   gpxNamespace,
+		Metadata: &gpxMetadata{
+			Name: "holiday-plan",
+			Time: time.Now().UTC().Format(time.RFC3339),
+		},
+		Routes: routes,
+	}
+	for _, mark := range waypoints.Markers {
+		g.Waypoints = append(g.Waypoints, markerToGPX(mark))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(g); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// SaveGPX saves the waypoints and routes to a file using WriteGPX.
+func SaveGPX(filename string, waypoints Markers, matches []Match, dist geodesy.Distance) error {
+	return saveGPX(filename, func(w io.Writer) error { return WriteGPX(w, waypoints, matches, dist) })
+}
+
+// saveGPX creates filename and writes to it with write.
+func saveGPX(filename string, write func(io.Writer) error) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
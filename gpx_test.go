@@ -0,0 +1,80 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+func TestWriteGPX(t *testing.T) {
+	langdon := Marker{Name: "Langdon Beck", Lat: 54.6755, Long: -2.2358, Kind: KindHostel, URL: "https://www.yha.org.uk/hostel/Langdon-Beck"}
+	high := Marker{Name: "High Force", Lat: 54.6503, Long: -2.1856, Kind: KindWaterfall}
+	low := Marker{Name: "Low Force", Lat: 54.6456, Long: -2.1592, Kind: KindWaterfall}
+	cauldron := Marker{Name: "Cauldron Snout", Lat: 54.6561, Long: -2.3128, Kind: KindWaterfall}
+
+	var buf bytes.Buffer
+	err := WriteGPX(&buf, Markers{Markers: []Marker{langdon, low, high, cauldron}},
+		[]Match{{Node: langdon, Childs: []Marker{low, high, cauldron}}}, geodesy.Haversine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var g gpx
+	if err := xml.Unmarshal(buf.Bytes(), &g); err != nil {
+		t.Fatalf("%v in\n%s", err, buf.String())
+	}
+	if g.XMLName.Space != gpxNamespace || g.Version != "1.1" {
+		t.Errorf("root = %v version %q; wanted GPX 1.1", g.XMLName, g.Version)
+	}
+	if len(g.Waypoints) != 4 {
+		t.Fatalf("got %d waypoints; wanted 4", len(g.Waypoints))
+	}
+	if w := g.Waypoints[0]; w.Name != langdon.Name || w.Lat != langdon.Lat || w.Lon != langdon.Long ||
+		w.Type != "hostel" || w.Link == nil || w.Link.Href != langdon.URL {
+		t.Errorf("first waypoint = %+v; wanted %+v", w, langdon)
+	}
+	if len(g.Routes) != 1 {
+		t.Fatalf("got %d routes; wanted 1", len(g.Routes))
+	}
+	var names []string
+	for _, p := range g.Routes[0].Points {
+		names = append(names, p.Name)
+	}
+	// the route goes to the nearest waterfalls first
+	want := []string{"Langdon Beck", "High Force", "Cauldron Snout", "Low Force"}
+	if len(names) != len(want) {
+		t.Fatalf("route = %q; wanted %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("route = %q; wanted %q", names, want)
+		}
+	}
+}
+
+func TestMatchRouteMetric(t *testing.T) {
+	// as in TestKDTreeMetric, East is nearer on the sphere,
+	// but North is on the ellipsoid
+	m := Match{Node: Marker{Name: "Hostel", Lat: 54, Long: -2}, Childs: []Marker{
+		{Name: "North", Lat: 54.09, Long: -2},
+		{Name: "East", Lat: 54, Long: -1.847},
+	}}
+	for _, tt := range []struct {
+		metric geodesy.Distance
+		want   string
+	}{
+		{geodesy.Haversine, "East"},
+		{geodesy.VincentyOrHaversine, "North"},
+	} {
+		if r := matchRoute(m, tt.metric); len(r) != 3 || r[0].Name != "Hostel" || r[1].Name != tt.want {
+			t.Errorf("matchRoute = %v; wanted Hostel then %s", r, tt.want)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// diskCache is a responseCache which keeps each response in a JSON
+// file under dir, named by the SHA-256 of its URL, so that pages can be
+// parsed again without downloading them, even offline.
+// It is safe for concurrent use.
+type diskCache struct {
+	dir string
+}
+
+// path is the file the response for url is kept in. The first byte of
+// the hash is a subdirectory so that no one directory gets too big.
+func (c diskCache) path(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	key := hex.EncodeToString(sum[:])
+	return filepath.Join(c.dir, key[:2], key[2:]+".json")
+}
+
+func (c diskCache) get(url string) (*cachedResponse, bool) {
+	b, err := ioutil.ReadFile(c.path(url))
+	if err != nil {
+		return nil, false
+	}
+	var r cachedResponse
+	// a different URL would be a hash collision
+	if err := json.Unmarshal(b, &r); err != nil || r.URL != url {
+		return nil, false
+	}
+	return &r, true
+}
+
+// put writes r to a temporary file which is then renamed, so that
+// a response is never read half written.
+func (c diskCache) put(r *cachedResponse) error {
+	fname := c.path(r.URL)
+	if err := os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(fname), ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Rename(f.Name(), fname); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
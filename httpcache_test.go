@@ -0,0 +1,130 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiskCache(t *testing.T) {
+	c := diskCache{dir: t.TempDir()}
+	url := "https://en.wikipedia.org/wiki/Aira_Force?action=raw"
+	if _, ok := c.get(url); ok {
+		t.Fatal("got a response from an empty cache")
+	}
+	want := &cachedResponse{
+		URL:     url,
+		Header:  http.Header{"Etag": {`"v1"`}},
+		Body:    []byte("{{coord|54.5753|-2.9309}}"),
+		Fetched: time.Date(2021, 3, 12, 6, 7, 0, 0, time.UTC),
+	}
+	if err := c.put(want); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := c.get(url)
+	if !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, %v; wanted %+v", got, ok, want)
+	}
+	if _, ok := c.get(url + "&x=1"); ok {
+		t.Error("got a response for a different URL")
+	}
+}
+
+func TestFetcherDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	var requests []*http.Request
+	transport := roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		requests = append(requests, r)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			return reply(r, http.StatusNotModified, nil, ""), nil
+		}
+		return reply(r, http.StatusOK, http.Header{"Etag": {`"v1"`}}, "Aira Force"), nil
+	})
+	newCached := func() *Fetcher {
+		f := newFetcher(transport, 0)
+		f.cache = diskCache{dir: dir}
+		f.TTL = time.Hour
+		return f
+	}
+	url := "https://example.com/aira"
+	get := func(f *Fetcher) {
+		t.Helper()
+		body, err := f.Get(context.Background(), url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "Aira Force" {
+			t.Errorf("body = %q", body)
+		}
+	}
+
+	// a later run uses the page without asking for it again
+	get(newCached())
+	get(newCached())
+	if len(requests) != 1 {
+		t.Errorf("made %d requests; wanted 1", len(requests))
+	}
+
+	// once it is stale it is revalidated, which makes it fresh again
+	stale := diskCache{dir: dir}
+	r, _ := stale.get(url)
+	r.Fetched = time.Now().Add(-2 * time.Hour)
+	stale.put(r)
+	get(newCached())
+	if len(requests) != 2 || requests[1].Header.Get("If-None-Match") != `"v1"` {
+		t.Fatalf("made %d requests; wanted a second, conditional one", len(requests))
+	}
+	if r, _ := stale.get(url); time.Since(r.Fetched) > time.Minute {
+		t.Errorf("revalidated page was fetched at %v", r.Fetched)
+	}
+
+	// offline, the cache is used however old it is,
+	// and pages not in it are errors
+	r.Fetched = time.Now().Add(-100 * time.Hour)
+	stale.put(r)
+	f := newCached()
+	f.Offline = true
+	get(f)
+	if _, err := f.Get(context.Background(), "https://example.com/other"); err == nil {
+		t.Error("got a page which isn't cached while offline")
+	}
+	if len(requests) != 2 {
+		t.Errorf("made %d requests; wanted no more offline", len(requests))
+	}
+}
+
+func TestCrawlWikiOffline(t *testing.T) {
+	useWikiServer(t, map[string]string{
+		"List":       "===[[England]]===\n*[[High Force]]\n",
+		"High_Force": "{{coord|54.65|-2.18|display=inline,title}}\n",
+	}, nil)
+	dir := t.TempDir()
+	online := newFetcher(nil, 0)
+	online.cache = diskCache{dir: dir}
+	want, err := crawlWiki(context.Background(), online, wikiPrefix+"List", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// with nothing to connect to, the pages can still be parsed again
+	offline := newFetcher(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		t.Errorf("requested %s while offline", r.URL)
+		return reply(r, http.StatusServiceUnavailable, nil, ""), nil
+	}), 0)
+	offline.cache = diskCache{dir: dir}
+	offline.Offline = true
+	got, err := crawlWiki(context.Background(), offline, wikiPrefix+"List", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Markers) != 1 || !reflect.DeepEqual(got.Markers, want.Markers) {
+		t.Errorf("offline crawl got %v; wanted %v", got.Markers, want.Markers)
+	}
+}
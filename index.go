@@ -0,0 +1,241 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// earthRadius is the radius of the sphere the kdTree works on.
+const earthRadius = geodesy.MeanRadius
+
+// sphereError is how much the distances given by any geodesy.Distance
+// may differ from those on the sphere, either way. The ellipsoid is
+// at most about 0.5% different.
+const sphereError = 1.01
+
+// vec3 is a point on the unit sphere.
+// The straight line (chord) distance between two of them grows with the
+// great-circle distance, so the nearest by one is the nearest by the other.
+type vec3 [3]float64
+
+func toVec3(m Marker) vec3 {
+	lat := m.Lat * math.Pi / 180
+	long := m.Long * math.Pi / 180
+	return vec3{math.Cos(lat) * math.Cos(long), math.Cos(lat) * math.Sin(long), math.Sin(lat)}
+}
+
+func (a vec3) chord2(b vec3) float64 {
+	dx, dy, dz := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+// chordToMeters converts the square of a chord to a great-circle distance.
+func chordToMeters(c2 float64) float64 {
+	return earthRadius * 2 * math.Asin(math.Min(1, math.Sqrt(c2)/2))
+}
+
+// metersToChord is the reverse of chordToMeters.
+func metersToChord(d float64) float64 {
+	if d >= math.Pi*earthRadius {
+		return 4
+	}
+	c := 2 * math.Sin(d/earthRadius/2)
+	return c * c
+}
+
+// kdTree is a spatial index of Markers for nearest neighbour queries.
+// The Markers are stored as points on the unit sphere, split
+// alternately along each axis, so queries take about O(log n) time
+// rather than the O(n) of a scan through every Marker.
+// The tree is searched using great-circle distances, and the Markers
+// found are then measured and ranked by dist, so the result is the
+// same as measuring every Marker by dist.
+type kdTree struct {
+	root *kdNode
+	dist geodesy.Distance
+}
+
+type kdNode struct {
+	mark        Marker
+	i           int // the index of mark in the Markers
+	p           vec3
+	axis        int
+	left, right *kdNode
+}
+
+// newKDTree builds a kdTree of the Markers in m, measured by dist.
+func newKDTree(m Markers, dist geodesy.Distance) *kdTree {
+	nodes := make([]kdNode, len(m.Markers))
+	for i, mark := range m.Markers {
+		nodes[i] = kdNode{mark: mark, i: i, p: toVec3(mark)}
+	}
+	return &kdTree{root: buildKD(nodes, 0), dist: dist}
+}
+
+// buildKD splits nodes at the median along axis, recursively.
+func buildKD(nodes []kdNode, axis int) *kdNode {
+	if len(nodes) == 0 {
+		return nil
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].p[axis] < nodes[j].p[axis] })
+	mid := len(nodes) / 2
+	n := &nodes[mid]
+	n.axis = axis
+	n.left = buildKD(nodes[:mid], (axis+1)%3)
+	n.right = buildKD(nodes[mid+1:], (axis+1)%3)
+	return n
+}
+
+// nearestIndex returns the index in the Markers t was built from
+// of the one nearest to m, or -1 if t is empty.
+func (t *kdTree) nearestIndex(m Marker) int {
+	ns := t.searchIndexed(m, 1, 0)
+	if len(ns) == 0 {
+		return -1
+	}
+	return ns[0].i
+}
+
+// kNearestIndex returns the indices in the Markers t was built from
+// of the k nearest to m, nearest first.
+func (t *kdTree) kNearestIndex(m Marker, k int) []int {
+	ns := t.searchIndexed(m, k, 0)
+	is := make([]int, len(ns))
+	for i, n := range ns {
+		is[i] = n.i
+	}
+	return is
+}
+
+// search returns the Markers within radius meters of m, nearest first,
+// and at most k of them.
+// If k or radius is not positive, it is not a limit.
+func (t *kdTree) search(m Marker, k int, radius float64) []Neighbour {
+	found := t.searchIndexed(m, k, radius)
+	ns := make([]Neighbour, len(found))
+	for i, f := range found {
+		ns[i] = f.Neighbour
+	}
+	return ns
+}
+
+// indexed is a Neighbour found in a kdTree, with its index
+// in the Markers the tree was built from.
+type indexed struct {
+	Neighbour
+	i int
+}
+
+// withinIndexed returns the Markers within radius meters of m,
+// nearest first, with the index of each.
+func (t *kdTree) withinIndexed(m Marker, radius float64) []indexed {
+	return t.searchIndexed(m, 0, radius)
+}
+
+// searchIndexed is search, but also gives the index of each Marker.
+// Of Markers at the same distance, the one first in the Markers comes first.
+func (t *kdTree) searchIndexed(m Marker, k int, radius float64) []indexed {
+	max := math.Inf(1)
+	if radius > 0 {
+		max = metersToChord(radius * sphereError)
+	}
+	s := kdSearch{p: toVec3(m), k: k, max: max}
+	s.visit(t.root)
+	if k > 0 && len(s.found) == k {
+		// the k nearest by t.dist are no further on the sphere
+		// than the furthest of the k nearest on it is by t.dist
+		var far float64
+		for _, f := range s.found {
+			far = math.Max(far, t.dist(m.point(), f.n.mark.point()))
+		}
+		s = kdSearch{p: s.p, max: math.Min(max, metersToChord(far*sphereError))}
+		s.visit(t.root)
+	}
+
+	ns := make([]indexed, len(s.found))
+	for i, f := range s.found {
+		ns[i] = indexed{Neighbour{Marker: f.n.mark, Distance: t.dist(m.point(), f.n.mark.point())}, f.n.i}
+	}
+	sort.Slice(ns, func(i, j int) bool {
+		if ns[i].Distance != ns[j].Distance {
+			return ns[i].Distance < ns[j].Distance
+		}
+		return ns[i].i < ns[j].i
+	})
+	if radius > 0 {
+		for len(ns) > 0 && ns[len(ns)-1].Distance > radius {
+			ns = ns[:len(ns)-1]
+		}
+	}
+	if k > 0 && len(ns) > k {
+		ns = ns[:k]
+	}
+	return ns
+}
+
+// kdSearch is the state of a search of a kdTree for the points nearest to p.
+type kdSearch struct {
+	p     vec3
+	k     int
+	max   float64 // the furthest (squared chord) a point can be to be found
+	found kdHeap
+}
+
+func (s *kdSearch) visit(n *kdNode) {
+	if n == nil {
+		return
+	}
+	if c2 := s.p.chord2(n.p); c2 <= s.max {
+		heap.Push(&s.found, kdFound{n: n, c2: c2})
+		if s.k > 0 && len(s.found) > s.k {
+			heap.Pop(&s.found)
+		}
+		if s.k > 0 && len(s.found) == s.k {
+			s.max = s.found[0].c2
+		}
+	}
+
+	diff := s.p[n.axis] - n.p[n.axis]
+	near, far := n.left, n.right
+	if diff > 0 {
+		near, far = far, near
+	}
+	s.visit(near)
+	// the other side can only have closer points if the splitting plane is close enough
+	if diff*diff <= s.max {
+		s.visit(far)
+	}
+}
+
+type kdFound struct {
+	n  *kdNode
+	c2 float64
+}
+
+// kdHeap is a max-heap of the points found so far, furthest first.
+// Of points at the same distance, the one first in the Markers is kept.
+type kdHeap []kdFound
+
+func (h kdHeap) Len() int { return len(h) }
+func (h kdHeap) Less(i, j int) bool {
+	if h[i].c2 != h[j].c2 {
+		return h[i].c2 > h[j].c2
+	}
+	return h[i].n.i > h[j].n.i
+}
+func (h kdHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *kdHeap) Push(x interface{}) { *h = append(*h, x.(kdFound)) }
+func (h *kdHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,264 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// randomMarkers returns n Markers scattered over Great Britain.
+func randomMarkers(r *rand.Rand, n int) Markers {
+	var m Markers
+	for i := 0; i < n; i++ {
+		m.Markers = append(m.Markers, Marker{
+			Name: fmt.Sprint(i),
+			Lat:  50 + r.Float64()*8.5,
+			Long: -6 + r.Float64()*7.5,
+		})
+	}
+	return m
+}
+
+func TestKDTree(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	nodes := randomMarkers(r, 500)
+	// some points far away, and a duplicate
+	nodes.Markers = append(nodes.Markers,
+		Marker{Name: "Abbotsford", Lat: 49.050377, Long: -122.299987},
+		Marker{Name: "Sydney", Lat: -33.85, Long: 151.2},
+		nodes.Markers[0])
+	queries := append(randomMarkers(r, 200).Markers, Marker{Name: "Wellington", Lat: -41.29, Long: 174.78})
+
+	for name, metric := range geodesy.Distances {
+		tree := newKDTree(nodes, metric)
+		for _, q := range queries {
+			// distances of every node from q
+			dist := make(map[string]float64)
+			for _, n := range nodes.Markers {
+				d := distanceBn(metric, q, n)
+				if old, ok := dist[n.Name]; !ok || d < old {
+					dist[n.Name] = d
+				}
+			}
+
+			best := math.Inf(1)
+			for _, d := range dist {
+				best = math.Min(best, d)
+			}
+			i := tree.nearestIndex(q)
+			if i < 0 || math.Abs(distanceBn(metric, q, nodes.Markers[i])-best) > 1e-6 {
+				t.Fatalf("%s: nearestIndex(%v) = %d; wanted one at %f m", name, q, i, best)
+			}
+
+			k := tree.search(q, 10, 0)
+			if len(k) != 10 || math.Abs(k[0].Distance-best) > 1e-6 {
+				t.Fatalf("%s: search(%v, 10, 0) = %v", name, q, k)
+			}
+			for i := 1; i < len(k); i++ {
+				if k[i].Distance < k[i-1].Distance {
+					t.Fatalf("%s: search(%v, 10, 0) not in order: %v", name, q, k)
+				}
+			}
+			for i, j := range tree.kNearestIndex(q, 10) {
+				if nodes.Markers[j].Name != k[i].Name {
+					t.Errorf("%s: kNearestIndex(%v, 10)[%d] = %s; wanted %s", name, q, i, nodes.Markers[j].Name, k[i].Name)
+				}
+			}
+			closer := 0
+			for _, d := range dist {
+				if d < k[9].Distance {
+					closer++
+				}
+			}
+			if closer > 9 {
+				t.Errorf("%s: %d nodes are closer to %v than the 10th nearest", name, closer, q)
+			}
+
+			const radius = 50000
+			in := 0
+			for _, n := range nodes.Markers {
+				if distanceBn(metric, q, n) <= radius {
+					in++
+				}
+			}
+			w := tree.withinIndexed(q, radius)
+			if len(w) != in {
+				t.Errorf("%s: withinIndexed(%v, %d) found %d; wanted %d", name, q, radius, len(w), in)
+			}
+			for _, n := range w {
+				if n.Distance > radius || nodes.Markers[n.i].Name != n.Name {
+					t.Errorf("%s: withinIndexed(%v, %d) found %s (%d) at %f m", name, q, radius, n.Name, n.i, n.Distance)
+				}
+			}
+		}
+	}
+
+	if i := newKDTree(Markers{}, geodesy.Haversine).nearestIndex(Marker{}); i != -1 {
+		t.Errorf("nearestIndex in an empty tree = %d; wanted -1", i)
+	}
+}
+
+func TestKDTreeMetric(t *testing.T) {
+	// East is nearer on the sphere, but North is on the ellipsoid
+	q := Marker{Lat: 54, Long: -2}
+	nodes := Markers{Markers: []Marker{
+		{Name: "East", Lat: 54, Long: -1.847},
+		{Name: "North", Lat: 54.09, Long: -2},
+	}}
+	for _, tt := range []struct {
+		metric geodesy.Distance
+		want   string
+	}{
+		{geodesy.Haversine, "East"},
+		{geodesy.VincentyOrHaversine, "North"},
+	} {
+		if i := newKDTree(nodes, tt.metric).nearestIndex(q); nodes.Markers[i].Name != tt.want {
+			t.Errorf("nearestIndex = %s; wanted %s", nodes.Markers[i].Name, tt.want)
+		}
+		if m := matchClosest(Markers{Markers: []Marker{q}}, nodes, tt.metric, nil); m[0].Node.Name != tt.want {
+			t.Errorf("matchClosest matched to %s; wanted %s", m[0].Node.Name, tt.want)
+		}
+	}
+}
+
+func TestChordDistance(t *testing.T) {
+	// London to Edinburgh is about 534 km
+	london := Marker{Lat: 51.5074, Long: -0.1278}
+	edinburgh := Marker{Lat: 55.9533, Long: -3.1883}
+	d := chordToMeters(toVec3(london).chord2(toVec3(edinburgh)))
+	if math.Abs(d-534e3) > 2e3 {
+		t.Errorf("London to Edinburgh = %.0f m; wanted about 534 km", d)
+	}
+	if c := metersToChord(d); math.Abs(c-toVec3(london).chord2(toVec3(edinburgh))) > 1e-12 {
+		t.Errorf("metersToChord(chordToMeters(c)) = %g; wanted c", c)
+	}
+}
+
+// linearClosest is matchClosest by scanning every node for each child,
+// as it was done before the k-d tree. It is the reference which the tree
+// is tested and benchmarked against.
+func linearClosest(childs, nodes Markers, dist geodesy.Distance) []Match {
+	matched := make([][]Marker, len(nodes.Markers))
+	for _, child := range childs.Markers {
+		closest, mdist := 0, math.Inf(1)
+		for i, n := range nodes.Markers {
+			if d := distanceBn(dist, child, n); d < mdist {
+				closest, mdist = i, d
+			}
+		}
+		matched[closest] = append(matched[closest], child)
+	}
+	var matches []Match
+	for i, m := range matched {
+		if len(m) != 0 {
+			matches = append(matches, Match{Node: nodes.Markers[i], Childs: m})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Node.Name < matches[j].Node.Name })
+	return matches
+}
+
+// linearNearest is matchNearest by scanning and sorting every node for each child.
+func linearNearest(childs, nodes Markers, k int, radius float64, dist geodesy.Distance) []Nearby {
+	nearby := make([]Nearby, len(childs.Markers))
+	for i, child := range childs.Markers {
+		var ns []Neighbour
+		for _, n := range nodes.Markers {
+			d := distanceBn(dist, child, n)
+			if radius > 0 && d > radius {
+				continue
+			}
+			ns = append(ns, Neighbour{Marker: n, Distance: d})
+		}
+		sort.SliceStable(ns, func(i, j int) bool { return ns[i].Distance < ns[j].Distance })
+		if k > 0 && len(ns) > k {
+			ns = ns[:k]
+		}
+		nearby[i] = Nearby{Marker: child, Neighbours: ns}
+	}
+	return nearby
+}
+
+func TestMatchLinear(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	nodes := randomMarkers(r, 300)
+	childs := randomMarkers(r, 300)
+	for name, metric := range geodesy.Distances {
+		got, want := matchClosest(childs, nodes, metric, nil), linearClosest(childs, nodes, metric)
+		if len(got) != len(want) {
+			t.Fatalf("%s: matchClosest matched to %d nodes; wanted %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i].Node.Name != want[i].Node.Name || len(got[i].Childs) != len(want[i].Childs) {
+				t.Errorf("%s: matchClosest matched %d to %s; wanted %d to %s", name,
+					len(got[i].Childs), got[i].Node.Name, len(want[i].Childs), want[i].Node.Name)
+			}
+		}
+
+		for _, tt := range []struct {
+			k      int
+			radius float64
+		}{{5, 0}, {0, 20000}, {3, 30000}} {
+			got, want := matchNearest(childs, nodes, tt.k, tt.radius, metric), linearNearest(childs, nodes, tt.k, tt.radius, metric)
+			for i := range want {
+				g, w := got[i].Neighbours, want[i].Neighbours
+				if len(g) != len(w) {
+					t.Fatalf("%s: matchNearest(%d, %.0f) found %d for %s; wanted %d", name, tt.k, tt.radius, len(g), want[i].Marker.Name, len(w))
+				}
+				for j := range w {
+					if g[j].Name != w[j].Name || math.Abs(g[j].Distance-w[j].Distance) > 1e-6 {
+						t.Errorf("%s: matchNearest(%d, %.0f) for %s: %d is %s at %f m; wanted %s at %f m", name, tt.k, tt.radius,
+							want[i].Marker.Name, j, g[j].Name, g[j].Distance, w[j].Name, w[j].Distance)
+					}
+				}
+			}
+		}
+	}
+}
+
+// benchmarkMatch times matching childs random Markers to nodes
+// with match, as the map page does.
+func benchmarkMatch(b *testing.B, nodes, childs int, match func(childs, nodes Markers)) {
+	r := rand.New(rand.NewSource(1))
+	ns := randomMarkers(r, nodes)
+	cs := randomMarkers(r, childs)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		match(cs, ns)
+	}
+}
+
+func closest(childs, nodes Markers) { matchClosest(childs, nodes, geodesy.Haversine, nil) }
+
+func nearest5(childs, nodes Markers) { matchNearest(childs, nodes, 5, 0, geodesy.Haversine) }
+
+func within20km(childs, nodes Markers) { matchNearest(childs, nodes, 0, 20000, geodesy.Haversine) }
+
+func closestLinear(childs, nodes Markers) { linearClosest(childs, nodes, geodesy.Haversine) }
+
+func nearest5Linear(childs, nodes Markers) { linearNearest(childs, nodes, 5, 0, geodesy.Haversine) }
+
+func within20kmLinear(childs, nodes Markers) {
+	linearNearest(childs, nodes, 0, 20000, geodesy.Haversine)
+}
+
+// The Linear benchmarks are the same matchings by scanning every node,
+// for comparison with the k-d tree.
+
+func BenchmarkMatchClosest200(b *testing.B)        { benchmarkMatch(b, 200, 200, closest) }
+func BenchmarkMatchClosest200Linear(b *testing.B)  { benchmarkMatch(b, 200, 200, closestLinear) }
+func BenchmarkMatchClosest5000(b *testing.B)       { benchmarkMatch(b, 5000, 5000, closest) }
+func BenchmarkMatchClosest5000Linear(b *testing.B) { benchmarkMatch(b, 5000, 5000, closestLinear) }
+func BenchmarkMatchNearest5(b *testing.B)          { benchmarkMatch(b, 5000, 1000, nearest5) }
+func BenchmarkMatchNearest5Linear(b *testing.B)    { benchmarkMatch(b, 5000, 1000, nearest5Linear) }
+func BenchmarkMatchWithin20km(b *testing.B)        { benchmarkMatch(b, 5000, 1000, within20km) }
+func BenchmarkMatchWithin20kmLinear(b *testing.B)  { benchmarkMatch(b, 5000, 1000, within20kmLinear) }
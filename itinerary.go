@@ -0,0 +1,252 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// planBeamWidth is how many of the best partial itineraries
+// planItinerary keeps after each night.
+const planBeamWidth = 100
+
+// Stay is a night of an Itinerary.
+type Stay struct {
+	Hostel Marker
+	// Travel is how far in meters it is from the last night's hostel.
+	Travel float64
+	// Waterfalls are those within walking range of Hostel
+	// which weren't in range of any earlier stay.
+	Waterfalls []Neighbour
+}
+
+// Itinerary is a plan of where to stay each night.
+type Itinerary struct {
+	Start Marker
+	Stays []Stay
+}
+
+// Waterfalls is the number of waterfalls in range of the Itinerary's stays.
+func (it Itinerary) Waterfalls() int {
+	n := 0
+	for _, s := range it.Stays {
+		n += len(s.Waterfalls)
+	}
+	return n
+}
+
+// Travel is the total distance in meters between the Itinerary's hostels.
+func (it Itinerary) Travel() float64 {
+	var d float64
+	for _, s := range it.Stays {
+		d += s.Travel
+	}
+	return d
+}
+
+// planState is a partial itinerary considered by planItinerary.
+type planState struct {
+	stays  []int
+	seen   map[int]bool
+	score  int
+	travel float64
+}
+
+// planItinerary chooses a hostel to stay at on each of nights nights,
+// starting from start, so that as many different waterfalls as possible
+// are within walkRange meters of where we stay. Each day's travel
+// between hostels, in a straight line measured by dist, is at most
+// maxDaily meters.
+// If walk isn't nil, a waterfall is only in range if it can be walked to
+// within walkRange along the paths.
+// It does a beam search, keeping the planBeamWidth best plans after
+// each night, so the plan is good but not always the best possible.
+// Of plans which reach as many waterfalls, the one with the least
+// travel is chosen. The Itinerary stops early if no hostel is in reach.
+func planItinerary(start Marker, hostels, waterfalls Markers, nights int, maxDaily, walkRange float64, dist geodesy.Distance, walk *walkMatcher) Itinerary {
+	hostelTree := newKDTree(hostels, dist)
+	inRange := waterfallsInRange(hostels, waterfalls, walkRange, dist, walk)
+
+	beam := []planState{{seen: map[int]bool{}}}
+	for night := 0; night < nights; night++ {
+		var next []planState
+		for _, st := range beam {
+			from := start
+			if len(st.stays) > 0 {
+				from = hostels.Markers[st.stays[len(st.stays)-1]]
+			}
+			for _, h := range hostelTree.withinIndexed(from, maxDaily) {
+				ns := planState{
+					// don't share the backing array with other states
+					stays:  append(st.stays[:len(st.stays):len(st.stays)], h.i),
+					seen:   st.seen,
+					score:  st.score,
+					travel: st.travel + h.Distance,
+				}
+				for _, f := range inRange[h.i] {
+					if ns.seen[f.i] {
+						continue
+					}
+					if ns.score == st.score {
+						// copy on the first new waterfall
+						ns.seen = copySet(st.seen)
+					}
+					ns.seen[f.i] = true
+					ns.score++
+				}
+				next = append(next, ns)
+			}
+		}
+		if len(next) == 0 {
+			break
+		}
+		sort.SliceStable(next, func(i, j int) bool {
+			if next[i].score != next[j].score {
+				return next[i].score > next[j].score
+			}
+			return next[i].travel < next[j].travel
+		})
+		if len(next) > planBeamWidth {
+			next = next[:planBeamWidth]
+		}
+		beam = next
+	}
+
+	it := Itinerary{Start: start}
+	from := start
+	seen := make(map[int]bool)
+	for _, h := range beam[0].stays {
+		s := Stay{Hostel: hostels.Markers[h], Travel: distanceBn(dist, from, hostels.Markers[h])}
+		for _, f := range inRange[h] {
+			if !seen[f.i] {
+				seen[f.i] = true
+				s.Waterfalls = append(s.Waterfalls, f.Neighbour)
+			}
+		}
+		it.Stays = append(it.Stays, s)
+		from = s.Hostel
+	}
+	return it
+}
+
+// waterfallsInRange returns the waterfalls within walkRange meters
+// of each hostel, nearest first, as planItinerary.
+func waterfallsInRange(hostels, waterfalls Markers, walkRange float64, dist geodesy.Distance, walk *walkMatcher) [][]indexed {
+	tree := newKDTree(waterfalls, dist)
+	inRange := make([][]indexed, len(hostels.Markers))
+	for i, h := range hostels.Markers {
+		near := tree.withinIndexed(h, walkRange)
+		if walk == nil || len(near) == 0 {
+			inRange[i] = near
+			continue
+		}
+		to := make([]Marker, len(near))
+		for j, n := range near {
+			to[j] = n.Marker
+		}
+		routes, ok := walk.routes(h, to)
+		for j, n := range near {
+			if ok[j] && routes[j].Distance <= walkRange {
+				n.Distance = routes[j].Distance
+				inRange[i] = append(inRange[i], n)
+			}
+		}
+		sort.SliceStable(inRange[i], func(a, b int) bool { return inRange[i][a].Distance < inRange[i][b].Distance })
+	}
+	return inRange
+}
+
+func copySet(s map[int]bool) map[int]bool {
+	c := make(map[int]bool, len(s)+1)
+	for k := range s {
+		c[k] = true
+	}
+	return c
+}
+
+// parseStart finds the start of an itinerary, given as either
+// "lat,long" or the name of one of the hostels.
+func parseStart(s string, hostels Markers) (Marker, error) {
+	if parts := strings.Split(s, ","); len(parts) == 2 {
+		lat, err1 := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		long, err2 := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err1 == nil && err2 == nil {
+			return Marker{Name: "Start", Lat: lat, Long: long}, nil
+		}
+	}
+	for _, h := range hostels.Markers {
+		if strings.EqualFold(h.Name, s) {
+			return h, nil
+		}
+	}
+	return Marker{}, fmt.Errorf("start %q is neither lat,long nor the name of a hostel", s)
+}
+
+// Text returns the Itinerary as plain text, a line for each night.
+func (it Itinerary) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Starting from %s (%f, %f):\n", it.Start.Name, it.Start.Lat, it.Start.Long)
+	for i, s := range it.Stays {
+		var names []string
+		for _, w := range s.Waterfalls {
+			names = append(names, fmt.Sprintf("%s (%.1f km)", w.Name, w.Distance/1000))
+		}
+		if len(names) == 0 {
+			names = []string{"none new"}
+		}
+		fmt.Fprintf(&b, "Night %d: %s, %.1f km away. Waterfalls: %s\n", i+1, s.Hostel.Name, s.Travel/1000, strings.Join(names, ", "))
+	}
+	fmt.Fprintf(&b, "%d waterfalls in %d nights, travelling %.1f km.\n", it.Waterfalls(), len(it.Stays), it.Travel()/1000)
+	return b.String()
+}
+
+// WriteGPX writes the Itinerary to w as a GPX file, with waypoints for
+// the start, hostels and waterfalls, a route from the start through
+// each night's hostel, and a route for each night from the hostel
+// to the waterfalls near it.
+func (it Itinerary) WriteGPX(w io.Writer) error {
+	waypoints := Markers{Markers: []Marker{it.Start}}
+	trip := []Marker{it.Start}
+	var routes []gpxRoute
+	for i, s := range it.Stays {
+		trip = append(trip, s.Hostel)
+		if !containsMarker(waypoints.Markers, s.Hostel) {
+			waypoints.Markers = append(waypoints.Markers, s.Hostel)
+		}
+		walk := []Marker{s.Hostel}
+		for _, w := range s.Waterfalls {
+			waypoints.Markers = append(waypoints.Markers, w.Marker)
+			walk = append(walk, w.Marker)
+		}
+		if len(s.Waterfalls) > 0 {
+			desc := fmt.Sprintf("From %s to the waterfalls near it", s.Hostel.Name)
+			routes = append(routes, newGPXRoute(fmt.Sprintf("Night %d: %s", i+1, s.Hostel.Name), desc, walk))
+		}
+	}
+	desc := fmt.Sprintf("%d nights from %s", len(it.Stays), it.Start.Name)
+	routes = append([]gpxRoute{newGPXRoute("Itinerary", desc, trip)}, routes...)
+	return writeGPX(w, waypoints, routes)
+}
+
+// SaveGPX saves the Itinerary to a file using WriteGPX.
+func (it Itinerary) SaveGPX(filename string) error {
+	return saveGPX(filename, it.WriteGPX)
+}
+
+func containsMarker(ms []Marker, m Marker) bool {
+	for _, o := range ms {
+		if o.Name == m.Name && o.Lat == m.Lat && o.Long == m.Long {
+			return true
+		}
+	}
+	return false
+}
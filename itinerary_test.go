@@ -0,0 +1,110 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// waterfallsAt returns n waterfalls about a km north of long.
+func waterfallsAt(long float64, n int) []Marker {
+	var ms []Marker
+	for i := 0; i < n; i++ {
+		ms = append(ms, Marker{Name: fmt.Sprintf("Force %g/%d", long, i), Lat: 54.01, Long: long + float64(i)*0.002, Kind: KindWaterfall})
+	}
+	return ms
+}
+
+func TestPlanItinerary(t *testing.T) {
+	// 0.3° of longitude is about 20 km here
+	x := Marker{Name: "X", Lat: 54, Long: -0.3, Kind: KindHostel}
+	y := Marker{Name: "Y", Lat: 54, Long: 0.3, Kind: KindHostel}
+	z := Marker{Name: "Z", Lat: 54, Long: 0.6, Kind: KindHostel}
+	far := Marker{Name: "Far", Lat: 54, Long: 3, Kind: KindHostel}
+	hostels := Markers{Markers: []Marker{far, x, y, z}}
+	var waterfalls Markers
+	waterfalls.Markers = append(waterfalls.Markers, waterfallsAt(-0.3, 2)...)
+	waterfalls.Markers = append(waterfalls.Markers, waterfallsAt(0.3, 1)...)
+	waterfalls.Markers = append(waterfalls.Markers, waterfallsAt(0.6, 5)...)
+	waterfalls.Markers = append(waterfalls.Markers, waterfallsAt(3, 9)...)
+	start := Marker{Name: "Start", Lat: 54, Long: 0}
+
+	// going to X first sees the most waterfalls on the first night,
+	// but Z is only in reach through Y
+	it := planItinerary(start, hostels, waterfalls, 2, 25000, 3000, geodesy.Haversine, nil)
+	if len(it.Stays) != 2 || it.Stays[0].Hostel.Name != "Y" || it.Stays[1].Hostel.Name != "Z" {
+		t.Fatalf("planned %+v; wanted Y then Z", it.Stays)
+	}
+	if it.Waterfalls() != 6 {
+		t.Errorf("planned %d waterfalls; wanted 6", it.Waterfalls())
+	}
+	if d := it.Stays[0].Travel; d < 19000 || d > 21000 {
+		t.Errorf("first day's travel = %f m; wanted about 20 km", d)
+	}
+
+	// a waterfall isn't counted twice by staying at the same hostel again
+	it = planItinerary(start, hostels, waterfalls, 4, 25000, 3000, geodesy.Haversine, nil)
+	if it.Waterfalls() != 6 || len(it.Stays) != 4 {
+		t.Errorf("planned %d waterfalls in %d nights; wanted 6 in 4", it.Waterfalls(), len(it.Stays))
+	}
+
+	// nowhere in reach
+	it = planItinerary(start, hostels, waterfalls, 2, 1000, 3000, geodesy.Haversine, nil)
+	if len(it.Stays) != 0 {
+		t.Errorf("planned %+v with no hostels in reach", it.Stays)
+	}
+
+	if text := it.Text(); !strings.Contains(text, "0 waterfalls in 0 nights") {
+		t.Errorf("Text() = %q", text)
+	}
+}
+
+func TestParseStart(t *testing.T) {
+	hostels := Markers{Markers: []Marker{{Name: "Langdon Beck", Lat: 54.6755, Long: -2.2358}}}
+	m, err := parseStart("54.5, -3.25", hostels)
+	if err != nil || m.Lat != 54.5 || m.Long != -3.25 {
+		t.Errorf("parseStart(lat,long) = %+v, %v", m, err)
+	}
+	m, err = parseStart("langdon beck", hostels)
+	if err != nil || m.Name != "Langdon Beck" {
+		t.Errorf("parseStart(hostel) = %+v, %v", m, err)
+	}
+	if _, err := parseStart("Nowhere", hostels); err == nil {
+		t.Error("parseStart found an unknown hostel")
+	}
+}
+
+func TestItineraryGPX(t *testing.T) {
+	y := Marker{Name: "Y", Lat: 54, Long: 0.3, Kind: KindHostel}
+	it := Itinerary{
+		Start: Marker{Name: "Start", Lat: 54, Long: 0},
+		Stays: []Stay{
+			{Hostel: y, Waterfalls: []Neighbour{{Marker: waterfallsAt(0.3, 1)[0]}}},
+			{Hostel: y},
+		},
+	}
+	var buf bytes.Buffer
+	if err := it.WriteGPX(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var g gpx
+	if err := xml.Unmarshal(buf.Bytes(), &g); err != nil {
+		t.Fatalf("%v in\n%s", err, buf.String())
+	}
+	if len(g.Waypoints) != 3 {
+		t.Errorf("got %d waypoints; wanted 3", len(g.Waypoints))
+	}
+	// the whole trip, and a walk from Y on the first night
+	if len(g.Routes) != 2 || len(g.Routes[0].Points) != 3 || len(g.Routes[1].Points) != 2 {
+		t.Errorf("routes = %+v", g.Routes)
+	}
+}
@@ -0,0 +1,306 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+// Package kml reads the placemarks in KML and KMZ files, and writes KML.
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// KML is the root element of a KML file.
+// It usually holds a single Document, but may hold Folders or Placemarks.
+type KML struct {
+	XMLName xml.Name `xml:"kml"`
+	Container
+}
+
+// Container is a Document or Folder, either of which may hold
+// more Documents, Folders and Placemarks.
+type Container struct {
+	Name        string      `xml:"name,omitempty"`
+	Description string      `xml:"description,omitempty"`
+	Styles      []Style     `xml:"Style"`
+	Documents   []Container `xml:"Document"`
+	Folders     []Container `xml:"Folder"`
+	Placemarks  []Placemark `xml:"Placemark"`
+}
+
+// Placemark is a named feature. Only those with a Point,
+// or a MultiGeometry holding Points, have a location.
+type Placemark struct {
+	Name          string         `xml:"name"`
+	Description   string         `xml:"description,omitempty"`
+	StyleURL      string         `xml:"styleUrl,omitempty"`
+	Point         *Point         `xml:"Point"`
+	MultiGeometry *MultiGeometry `xml:"MultiGeometry"`
+	// Link is an atom:link to a page about the Placemark.
+	Link         *AtomLink     `xml:"http://www.w3.org/2005/Atom link,omitempty"`
+	ExtendedData *ExtendedData `xml:"ExtendedData,omitempty"`
+}
+
+// AtomLink is an atom:link element.
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+// ExtendedData holds named values added to a Placemark.
+type ExtendedData struct {
+	Data []Data `xml:"Data"`
+}
+
+// Data is a named value in ExtendedData.
+type Data struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+// linkData are the names of Data which hold a link to a page about a Placemark.
+var linkData = []string{"url", "link", "website"}
+
+// URL returns the link to a page about pm: its atom:link, else a url,
+// link or website in its ExtendedData, or "" if it has neither.
+// Links in the description aren't used, as they are often citations
+// rather than the place's own page.
+func (pm Placemark) URL() string {
+	if pm.Link != nil && pm.Link.Href != "" {
+		return strings.TrimSpace(pm.Link.Href)
+	}
+	if pm.ExtendedData != nil {
+		for _, name := range linkData {
+			for _, d := range pm.ExtendedData.Data {
+				if strings.EqualFold(d.Name, name) && strings.TrimSpace(d.Value) != "" {
+					return strings.TrimSpace(d.Value)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// Point holds a position as "long,lat[,alt]".
+type Point struct {
+	Coordinates string `xml:"coordinates"`
+}
+
+// MultiGeometry is a group of geometries, of which only Points are read.
+type MultiGeometry struct {
+	Points []Point `xml:"Point"`
+}
+
+// Place is a location read from a Placemark.
+type Place struct {
+	Name        string
+	Description string
+	// URL is the Placemark's link, from Placemark.URL.
+	URL       string
+	Lat, Long float64
+	// Folders are the names of the Documents and Folders the Placemark
+	// is in, outermost first. Containers without a name are left out.
+	Folders []string
+}
+
+// Category is the name of the innermost folder the Place is in,
+// or "" if it is not in a named folder.
+func (p Place) Category() string {
+	if len(p.Folders) == 0 {
+		return ""
+	}
+	return p.Folders[len(p.Folders)-1]
+}
+
+// InFolder reports whether the Place is in a Document or Folder
+// with one of the names, at any depth.
+func (p Place) InFolder(names ...string) bool {
+	for _, f := range p.Folders {
+		for _, n := range names {
+			if f == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PlacemarkError is a Placemark which couldn't be read.
+type PlacemarkError struct {
+	Name string
+	Err  error
+}
+
+func (e PlacemarkError) Error() string {
+	return fmt.Sprintf("placemark %q: %v", e.Name, e.Err)
+}
+
+// SkippedError lists the Placemarks which were left out because they
+// couldn't be read. It is returned along with the Places which could.
+type SkippedError []PlacemarkError
+
+func (e SkippedError) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v (and %d more placemarks)", e[0], len(e)-1)
+}
+
+// Read reads the Places in a KML document from r,
+// walking every nested Document and Folder.
+// Placemarks with bad coordinates are skipped, and if there are any,
+// the error is a SkippedError and the other Places are still returned.
+func Read(r io.Reader) ([]Place, error) {
+	var k KML
+	if err := xml.NewDecoder(r).Decode(&k); err != nil {
+		return nil, err
+	}
+	return k.Places()
+}
+
+// Places returns the Places in k, in the order they appear.
+// Placemarks which can't be read are left out and listed in a SkippedError.
+func (k *KML) Places() ([]Place, error) {
+	var places []Place
+	var skipped SkippedError
+	k.Container.walk(nil, &places, &skipped)
+	if len(skipped) > 0 {
+		return places, skipped
+	}
+	return places, nil
+}
+
+// walk appends the Places in c and its children to places,
+// and the Placemarks which can't be read to skipped.
+// folders are the names of the containers c is in.
+func (c *Container) walk(folders []string, places *[]Place, skipped *SkippedError) {
+	if c.Name != "" {
+		// don't share the backing array with sibling containers
+		folders = append(folders[:len(folders):len(folders)], strings.TrimSpace(c.Name))
+	}
+	for _, pm := range c.Placemarks {
+		points := pm.MultiGeometry.points()
+		if pm.Point != nil {
+			points = append([]Point{*pm.Point}, points...)
+		}
+		var found []Place
+		for _, pt := range points {
+			lat, long, err := pt.Position()
+			if err != nil {
+				*skipped = append(*skipped, PlacemarkError{Name: strings.TrimSpace(pm.Name), Err: err})
+				found = nil
+				break
+			}
+			found = append(found, Place{
+				Name:        strings.TrimSpace(pm.Name),
+				Description: strings.TrimSpace(pm.Description),
+				URL:         pm.URL(),
+				Lat:         lat,
+				Long:        long,
+				Folders:     folders,
+			})
+		}
+		*places = append(*places, found...)
+	}
+	for i := range c.Documents {
+		c.Documents[i].walk(folders, places, skipped)
+	}
+	for i := range c.Folders {
+		c.Folders[i].walk(folders, places, skipped)
+	}
+}
+
+func (mg *MultiGeometry) points() []Point {
+	if mg == nil {
+		return nil
+	}
+	return mg.Points
+}
+
+// Position parses the latitude and longitude of the Point.
+func (pt Point) Position() (lat, long float64, err error) {
+	fields := strings.Split(strings.TrimSpace(pt.Coordinates), ",")
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("coordinates %q: want long,lat", pt.Coordinates)
+	}
+	if long, err = strconv.ParseFloat(strings.TrimSpace(fields[0]), 64); err != nil {
+		return 0, 0, err
+	}
+	if lat, err = strconv.ParseFloat(strings.TrimSpace(fields[1]), 64); err != nil {
+		return 0, 0, err
+	}
+	if math.Abs(lat) > 90 || math.Abs(long) > 180 {
+		return 0, 0, fmt.Errorf("coordinates %q out of range", pt.Coordinates)
+	}
+	return lat, long, nil
+}
+
+// ReadFile reads the Places in a KML or KMZ file.
+// KMZ files are recognised by their contents, not their name.
+// As with Read, a SkippedError comes with the Places which could be read.
+func ReadFile(filename string) ([]Place, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var places []Place
+	if bytes.HasPrefix(b, []byte("PK\x03\x04")) {
+		places, err = ReadKMZ(bytes.NewReader(b), int64(len(b)))
+	} else {
+		places, err = Read(bytes.NewReader(b))
+	}
+	var skipped SkippedError
+	if errors.As(err, &skipped) {
+		return places, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return places, nil
+}
+
+// ReadKMZ reads the Places in a KMZ archive of the given size.
+// The KML is read from doc.kml, or if there is none,
+// the first file in the archive with a .kml extension.
+func ReadKMZ(r io.ReaderAt, size int64) ([]Place, error) {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	var doc *zip.File
+	for _, f := range z.File {
+		if f.Name == "doc.kml" {
+			doc = f
+			break
+		}
+		if doc == nil && strings.EqualFold(path.Ext(f.Name), ".kml") {
+			doc = f
+		}
+	}
+	if doc == nil {
+		return nil, errors.New("no KML file in KMZ archive")
+	}
+	rc, err := doc.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	places, err := Read(rc)
+	var skipped SkippedError
+	if errors.As(err, &skipped) {
+		return places, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", doc.Name, err)
+	}
+	return places, nil
+}
@@ -0,0 +1,165 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package kml
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const nested = `<?xml version="1.0" encoding="UTF-8"?>
+<kml xmlns="http://www.opengis.net/kml/2.2">
+<Document>
+	<name>Hostels</name>
+	<Placemark>
+		<name>Loose</name>
+		<Point><coordinates>-1.5,53.5</coordinates></Point>
+	</Placemark>
+	<Folder>
+		<name><![CDATA[Current YHA hostels]]></name>
+		<Placemark>
+			<name> Edale </name>
+			<description>In the Peak District</description>
+			<Point><coordinates>-1.791024,53.376148,0</coordinates></Point>
+		</Placemark>
+		<Folder>
+			<name>Closed for winter</name>
+			<Placemark>
+				<name>Black Sail</name>
+				<Point><coordinates> -3.2436, 54.4977, 0 </coordinates></Point>
+			</Placemark>
+		</Folder>
+	</Folder>
+	<Folder>
+		<Placemark>
+			<name>Twins</name>
+			<MultiGeometry>
+				<Point><coordinates>-2,54</coordinates></Point>
+				<LineString><coordinates>-2,54 -2.1,54.1</coordinates></LineString>
+				<Point><coordinates>-2.1,54.1</coordinates></Point>
+			</MultiGeometry>
+		</Placemark>
+		<Placemark>
+			<name>A path</name>
+			<LineString><coordinates>-2,54 -2.1,54.1</coordinates></LineString>
+		</Placemark>
+	</Folder>
+</Document>
+</kml>`
+
+func TestRead(t *testing.T) {
+	got, err := Read(strings.NewReader(nested))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Place{
+		{Name: "Loose", Lat: 53.5, Long: -1.5, Folders: []string{"Hostels"}},
+		{Name: "Edale", Description: "In the Peak District", Lat: 53.376148, Long: -1.791024,
+			Folders: []string{"Hostels", "Current YHA hostels"}},
+		{Name: "Black Sail", Lat: 54.4977, Long: -3.2436,
+			Folders: []string{"Hostels", "Current YHA hostels", "Closed for winter"}},
+		{Name: "Twins", Lat: 54, Long: -2, Folders: []string{"Hostels"}},
+		{Name: "Twins", Lat: 54.1, Long: -2.1, Folders: []string{"Hostels"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Read = %+v\nwanted %+v", got, want)
+	}
+
+	if c := got[2].Category(); c != "Closed for winter" {
+		t.Errorf("Category = %q; wanted %q", c, "Closed for winter")
+	}
+	if !got[2].InFolder("Current YHA hostels") {
+		t.Errorf("%s not in its parent folder", got[2].Name)
+	}
+	if got[0].InFolder("Current YHA hostels", "Independent hostels") {
+		t.Errorf("%s in a folder it isn't in", got[0].Name)
+	}
+}
+
+func TestPlacemarkURL(t *testing.T) {
+	in := `<kml xmlns="http://www.opengis.net/kml/2.2" xmlns:atom="http://www.w3.org/2005/Atom"><Document>
+	<Placemark><name>Atom</name><atom:link href="https://www.yha.org.uk/hostel/yha-edale"/>
+		<ExtendedData><Data name="url"><value>https://example.com/data</value></Data></ExtendedData>
+		<Point><coordinates>-1.79,53.37</coordinates></Point></Placemark>
+	<Placemark><name>Data</name>
+		<ExtendedData><Data name="beds"><value>30</value></Data><Data name="Website"><value> https://example.com/data </value></Data></ExtendedData>
+		<description><![CDATA[<a href="https://example.com/description">more</a>]]></description>
+		<Point><coordinates>-1.79,53.37</coordinates></Point></Placemark>
+	<Placemark><name>Description</name>
+		<description><![CDATA[Source: <a href="https://example.com/a?b=1&amp;c=2">list</a>]]></description>
+		<Point><coordinates>-1.79,53.37</coordinates></Point></Placemark>
+	<Placemark><name>None</name><description>No link</description>
+		<Point><coordinates>-1.79,53.37</coordinates></Point></Placemark>
+	</Document></kml>`
+	got, err := Read(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://www.yha.org.uk/hostel/yha-edale", "https://example.com/data", "", ""}
+	for i, p := range got {
+		if p.URL != want[i] {
+			t.Errorf("%s: URL = %q; wanted %q", p.Name, p.URL, want[i])
+		}
+	}
+}
+
+func TestReadSkips(t *testing.T) {
+	for _, bad := range []string{"-2", "west,54", "54,-200"} {
+		in := `<kml><Document><Placemark><name>x</name><Point><coordinates>` + bad + `</coordinates></Point></Placemark>` +
+			`<Placemark><name>y</name><Point><coordinates>-2.9,54.5</coordinates></Point></Placemark></Document></kml>`
+		got, err := Read(strings.NewReader(in))
+		var skipped SkippedError
+		if !errors.As(err, &skipped) || len(skipped) != 1 || skipped[0].Name != "x" {
+			t.Errorf("Read with coordinates %q: error %v; wanted x skipped", bad, err)
+		}
+		if len(got) != 1 || got[0].Name != "y" {
+			t.Errorf("Read with coordinates %q = %+v; wanted y", bad, got)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, in := range []string{
+		`<kml><Document>`,
+		`<gpx></gpx>`,
+	} {
+		if _, err := Read(strings.NewReader(in)); err == nil {
+			t.Errorf("Read(%s) succeeded; wanted an error", in)
+		}
+	}
+}
+
+func TestReadKMZ(t *testing.T) {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"files/icon.png": "not really a png",
+		"doc.kml":        nested,
+	} {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadKMZ(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 5 || got[1].Name != "Edale" {
+		t.Errorf("ReadKMZ = %+v; wanted the 5 places in doc.kml", got)
+	}
+}
@@ -0,0 +1,84 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package kml
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Namespace is the XML namespace of KML 2.2.
+const Namespace = "http://www.opengis.net/kml/2.2"
+
+// Style is a shared style, which Placemarks refer to
+// with a StyleURL of "#" followed by its ID.
+type Style struct {
+	ID        string     `xml:"id,attr"`
+	IconStyle *IconStyle `xml:"IconStyle"`
+}
+
+// IconStyle is how a Placemark's Point is drawn.
+type IconStyle struct {
+	// Color is in the form aabbggrr; see Color.
+	Color string  `xml:"color,omitempty"`
+	Scale float64 `xml:"scale,omitempty"`
+	Icon  *Icon   `xml:"Icon"`
+}
+
+// Icon is the image for an IconStyle.
+type Icon struct {
+	Href string `xml:"href"`
+}
+
+// Color converts a html colour like "#0044ff" to the
+// opaque KML colour "ffff4400", which is in the order
+// alpha, blue, green, red.
+func Color(html string) (string, error) {
+	hex := strings.TrimPrefix(html, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	if len(hex) != 6 {
+		return "", fmt.Errorf("colour %q is not #rrggbb", html)
+	}
+	if _, err := strconv.ParseUint(hex, 16, 32); err != nil {
+		return "", fmt.Errorf("colour %q is not #rrggbb", html)
+	}
+	return strings.ToLower("ff" + hex[4:6] + hex[2:4] + hex[0:2]), nil
+}
+
+// NewPlacemark returns a Placemark with a Point at lat, long.
+func NewPlacemark(name, description string, lat, long float64) Placemark {
+	return Placemark{
+		Name:        name,
+		Description: description,
+		Point: &Point{
+			Coordinates: strconv.FormatFloat(long, 'f', -1, 64) + "," + strconv.FormatFloat(lat, 'f', -1, 64),
+		},
+	}
+}
+
+// Write writes k to w as an indented KML document.
+// The namespace it was read with is kept, or else it is Namespace.
+func (k *KML) Write(w io.Writer) error {
+	root := xml.StartElement{Name: xml.Name{Space: k.XMLName.Space, Local: "kml"}}
+	if root.Name.Space == "" {
+		root.Name.Space = Namespace
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.EncodeElement(k, root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
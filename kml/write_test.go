@@ -0,0 +1,73 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package kml
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestColor(t *testing.T) {
+	for html, want := range map[string]string{
+		"#550000": "ff000055",
+		"#0044ff": "ffff4400",
+		"#0055FF": "ffff5500",
+		"#abc":    "ffccbbaa",
+	} {
+		got, err := Color(html)
+		if err != nil || got != want {
+			t.Errorf("Color(%q) = %q, %v; wanted %q", html, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "#12345", "#gg0000", "red"} {
+		if got, err := Color(bad); err == nil {
+			t.Errorf("Color(%q) = %q; wanted an error", bad, got)
+		}
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	pm := NewPlacemark("Aira Force", `<a href="https://en.wikipedia.org/wiki/Aira_Force">Aira Force</a> & co`, 54.576303, -2.930905)
+	pm.StyleURL = "#waterfalls"
+	pm.Link = &AtomLink{Href: "https://en.wikipedia.org/wiki/Aira_Force"}
+	k := KML{Container: Container{Documents: []Container{{
+		Name:   "holiday-plan",
+		Styles: []Style{{ID: "waterfalls", IconStyle: &IconStyle{Color: "ffff4400"}}},
+		Folders: []Container{{
+			Name:       "Waterfalls",
+			Placemarks: []Placemark{pm},
+		}},
+	}}}}
+
+	var buf bytes.Buffer
+	if err := k.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{`<?xml`, `<kml xmlns="` + Namespace + `">`, `<styleUrl>#waterfalls</styleUrl>`, `<color>ffff4400</color>`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Write output has no %s:\n%s", want, out)
+		}
+	}
+
+	got, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Place{{
+		Name:        pm.Name,
+		Description: pm.Description,
+		URL:         "https://en.wikipedia.org/wiki/Aira_Force",
+		Lat:         54.576303,
+		Long:        -2.930905,
+		Folders:     []string{"holiday-plan", "Waterfalls"},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Read(Write(k)) = %+v; wanted %+v", got, want)
+	}
+}
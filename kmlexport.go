@@ -0,0 +1,104 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+	"github.com/aabacchus/holiday-plan/kml"
+)
+
+// kmlDataset is a set of Markers to go in its own folder of a KML file,
+// drawn in color.
+type kmlDataset struct {
+	name  string
+	m     Markers
+	color string
+}
+
+// markerKey identifies a Marker in the maps made by SaveKML.
+type markerKey struct {
+	name      string
+	lat, long float64
+}
+
+func keyOf(m Marker) markerKey {
+	return markerKey{m.Name, m.Lat, m.Long}
+}
+
+// SaveKML saves the hostels and waterfalls to a KML file with
+// a folder for each set, coloured as on the Mapbox map.
+// Each waterfall's description gives the hostel nearest to it,
+// and each hostel's the waterfalls it is nearest to, as found by exportMatches
+// with distances measured by dist, or by walk if it isn't nil.
+func SaveKML(filename string, hostels, waterfalls, scotlands, scotHostels Markers, dist geodesy.Distance, walk *walkMatcher) error {
+	nearest := make(map[markerKey]Marker)
+	closestTo := make(map[markerKey][]Marker)
+	for _, match := range exportMatches(waterfalls, hostels, dist, walk) {
+		closestTo[keyOf(match.Node)] = match.Childs
+		for _, c := range match.Childs {
+			nearest[keyOf(c)] = match.Node
+		}
+	}
+
+	doc := kml.Container{Name: "holiday-plan"}
+	for _, d := range []kmlDataset{
+		{"Hostels", hostels, hostelColor},
+		{"Waterfalls", waterfalls, waterfallColor},
+		{"Scottish waterfalls", scotlands, scotlandColor},
+		{"Scottish hostels", scotHostels, hostelColor},
+	} {
+		color, err := kml.Color(d.color)
+		if err != nil {
+			return err
+		}
+		id := strings.ToLower(strings.ReplaceAll(d.name, " ", "-"))
+		doc.Styles = append(doc.Styles, kml.Style{
+			ID:        id,
+			IconStyle: &kml.IconStyle{Color: color},
+		})
+
+		folder := kml.Container{Name: d.name}
+		for _, mark := range d.m.Markers {
+			desc := markerLink(mark)
+			if mark.Country != "" {
+				desc += "<br>" + mark.Country
+			}
+			if h, ok := nearest[keyOf(mark)]; ok {
+				desc += fmt.Sprintf("<br>Nearest hostel: %s (%.1f km)", markerLink(h), distanceBn(dist, h, mark)/1000)
+			}
+			if ws := closestTo[keyOf(mark)]; len(ws) > 0 {
+				links := make([]string, len(ws))
+				for i, w := range ws {
+					links[i] = markerLink(w)
+				}
+				desc += "<br>Closest waterfalls: " + strings.Join(links, ", ")
+			}
+			pm := kml.NewPlacemark(mark.Name, desc, mark.Lat, mark.Long)
+			pm.StyleURL = "#" + id
+			// so that the link is read back as the Place's URL
+			if mark.URL != "" {
+				pm.Link = &kml.AtomLink{Href: mark.URL}
+			}
+			folder.Placemarks = append(folder.Placemarks, pm)
+		}
+		doc.Folders = append(doc.Folders, folder)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	k := kml.KML{Container: kml.Container{Documents: []kml.Container{doc}}}
+	if err := k.Write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,57 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aabacchus/holiday-plan/kml"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+func TestSaveKML(t *testing.T) {
+	hostels := Markers{Markers: []Marker{
+		{Name: "Langdon Beck", Lat: 54.6755, Long: -2.2358, Kind: KindHostel},
+		{Name: "Edale", Lat: 53.376148, Long: -1.791024, Kind: KindHostel},
+	}}
+	waterfalls := Markers{Markers: []Marker{
+		{Name: "High Force", Lat: 54.6503, Long: -2.1856, Kind: KindWaterfall, Country: "England"},
+	}}
+	scotlands := Markers{Markers: []Marker{{Name: "Steall Falls", Lat: 56.7784, Long: -4.9634}}}
+	scotHostels := Markers{Markers: []Marker{{Name: "Glen Nevis", Lat: 56.8048, Long: -5.0705}}}
+
+	fname := filepath.Join(t.TempDir(), "holiday-plan.kml")
+	if err := SaveKML(fname, hostels, waterfalls, scotlands, scotHostels, geodesy.Haversine, nil); err != nil {
+		t.Fatal(err)
+	}
+	places, err := kml.ReadFile(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(places) != 5 {
+		t.Fatalf("read %d places; wanted 5", len(places))
+	}
+	byName := make(map[string]kml.Place)
+	for _, p := range places {
+		byName[p.Name] = p
+	}
+	if d := byName["High Force"].Description; !strings.Contains(d, "Nearest hostel: Langdon Beck") {
+		t.Errorf("High Force description = %q; wanted it to give Langdon Beck as nearest", d)
+	}
+	if d := byName["Langdon Beck"].Description; !strings.Contains(d, "Closest waterfalls: High Force") {
+		t.Errorf("Langdon Beck description = %q; wanted it to list High Force", d)
+	}
+	// the Scottish sets aren't matched
+	if d := byName["Steall Falls"].Description; strings.Contains(d, "Nearest hostel") {
+		t.Errorf("Steall Falls description = %q; wanted no nearest hostel", d)
+	}
+	if c := byName["Glen Nevis"].Category(); c != "Scottish hostels" {
+		t.Errorf("Glen Nevis is in folder %q; wanted %q", c, "Scottish hostels")
+	}
+}
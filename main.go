@@ -17,50 +17,168 @@
 package main
 
 import (
-	"encoding/csv"
-	"encoding/xml"
+	"context"
+	"database/sql"
 	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"math"
-	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+	"github.com/aabacchus/holiday-plan/kml"
+	"github.com/aabacchus/holiday-plan/routing"
 )
 
 var (
-	verbose *bool
+	verbose = new(bool)
+	// wikiPrefix is the start of every Wikipedia page URL.
+	wikiPrefix = "https://en.wikipedia.org/wiki/"
+	// wikiAPI is the MediaWiki API endpoint for the same Wikipedia.
+	wikiAPI = "https://en.wikipedia.org/w/api.php"
 )
 
+// yhaFolder is the folder of hostels.xml with the current YHA hostels.
+const yhaFolder = "Current YHA hostels"
+
+// folderList is a flag which can be given more than once, to read
+// several KML folders; the names can have commas in. Setting it
+// replaces the default, and setting it to "" reads every folder.
+type folderList struct {
+	folders []string
+	set     bool
+}
+
+func (f *folderList) String() string {
+	return strings.Join(f.folders, "; ")
+}
+
+func (f *folderList) Set(s string) error {
+	if !f.set {
+		f.folders, f.set = nil, true
+	}
+	if s != "" {
+		f.folders = append(f.folders, s)
+	}
+	return nil
+}
+
 func usage() {
-	fmt.Fprintf(os.Stderr, "usage: %s\t[-v] [-h]\n"+
-		"\t\t\t[-hostelFile hostels.xml] [-waterfallsURL https://en.wikipedia.org/wiki/List...]\n"+
-		"\t\t\t[-use-cache] [-hostelCache hostels_cache.csv] [-waterfallCache waterfalls_cache.csv]\n"+
-		"\t\t\t[-static] [-mappage]\n"+
+	fmt.Fprintf(os.Stderr, "usage: %s\t[-v] [-h] [-config holiday-plan.json]\n"+
+		"\t\t\t[-hostelFile hostels.xml] [-hostelFolders folder]... [-niHostelFile hini.kml]\n"+
+		"\t\t\t[-waterfallsURL https://en.wikipedia.org/wiki/List...]\n"+
+		"\t\t\t[-waterfallFile waterfalls.geojson]\n"+
+		"\t\t\t[-workers 4] [-rate 200ms] [-httpCache dir] [-httpTTL 24h] [-offline]\n"+
+		"\t\t\t[-use-cache | -refresh [-refreshReport changes.txt]] [-hostelCache hostels_cache.csv] [-waterfallCache waterfalls_cache.csv]\n"+
+		"\t\t\t[-static] [-mappage] [-pagesDir docs] [-k 1] [-radius km] [-hostelRadius km]\n"+
+		"\t\t\t[-distance haversine|vincenty] [-osm extract.osm.pbf] [-metric straight|walking|time]\n"+
 		"\t\t\t ↳ [-mapboxuname] [-mapboxapi] [-mapboxstyle]\n"+
-		"\t\t\t[-sqluname username] [-sqlpwd password] [-sqldb myDB]\n\n", os.Args[0])
+		"\t\t\t[-sqldriver sqlite3] [-sqluname username] [-sqlpwd password] [-sqldb myDB]\n"+
+		"\t\t\t[-export geojson,kml] [-exportDir .] [-gpx plan.gpx]\n"+
+		"\t\t\t[-plan nights -planStart lat,long|hostel] [-maxDaily km] [-walkRange km]\n"+
+		"\t\t\t ↳ [-planHTML itinerary.html] [-planGPX itinerary.gpx]\n"+
+		"\t\t\t[-tour waterfall,...|all] [-tourStart hostel] [-tourEnd hostel]\n"+
+		"\t\t\t[-bbox minLong,minLat,maxLong,maxLat|uk] [-near lat,long,km] [-region park.geojson]\n"+
+		"\t\t\t[-validate] [-validRegion uk] [-dropInvalid] [-mergeReport merges.txt]\n\n", os.Args[0])
 	flag.PrintDefaults()
 	fmt.Fprintf(os.Stderr, "\nholiday-plan is a program to get, save, or plot data about hostels and waterfalls in the UK.\n"+
-		"If a SQL username is provided, the SQL database is either written to using the obtained data, or read from, if use-cache is true.\n"+
-		"If -mappage is given, the pages will be generated as docs/index.html and docs/map.html")
+		"If a SQL database is provided, it is either written to using the obtained data, or read from, if use-cache is true.\n"+
+		"For sqlite3 the database is a filename and no username is needed; mysql is only available if built with -tags mysql.\n"+
+		"If -mappage is given, the pages will be generated as index.html and map.html in pagesDir.\n"+
+		"With -k or -radius, index.html also lists the nearest hostels to each waterfall with their distances,\n"+
+		"and with -hostelRadius the waterfalls within that distance of each hostel.\n"+
+		"With -osm and -metric walking or time, waterfalls are matched to the hostel with the shortest walk\n"+
+		"(of the few nearest in a straight line) along the paths and roads in the OpenStreetMap extract.\n"+
+		"-metric time only counts the climb between nodes tagged with their ele(vation), which few are\n"+
+		"in OpenStreetMap, so it is mostly the same as -metric walking.\n"+
+		"The hostelFile may be KML, KMZ or GeoJSON (if its name ends in .geojson or .json).\n"+
+		"Only hostels in the hostelFolders of a KML file are read; -hostelFolders can be given once for\n"+
+		"each folder, and hostels.xml also has\n"+
+		"\"Independent hostels\" and \"Other hostels, including former ones\".\n"+
+		"If -export geojson is given, each set of markers is written to a GeoJSON file in exportDir.\n"+
+		"If -export kml is given, they are all written to holiday-plan.kml in exportDir, to open in Google Earth.\n"+
+		"If -gpx is given, every marker is written to it as a waypoint, with a route from each hostel\n"+
+		"to the waterfalls it is closest to (in England and Wales only, as on the map), for GPS devices.\n"+
+		"With -plan, an itinerary is printed which stays at a hostel each night, no more than maxDaily km\n"+
+		"from the last, to be within walkRange km of as many different waterfalls as possible.\n"+
+		"With -tour, a short route visiting the waterfalls is printed, and drawn on the map with -mappage.\n"+
+		"With -bbox, -near or -region, only the markers in all of the given areas are matched, mapped and\n"+
+		"exported; the caches still have every marker. Scottish hostels outside the UK are always left out.\n"+
+		"With -validate, markers at 0,0, with impossible or swapped coordinates, outside validRegion or\n"+
+		"duplicated are listed; with -dropInvalid they are also left out, before the data is cached.\n"+
+		"Places listed more than once close together, with similar names, the same URL or in both lists,\n"+
+		"are merged, keeping their other names and sources; -mergeReport lists what was merged for review.\n"+
+		"With -refresh, the data is fetched again and compared with the caches, listing the markers added,\n"+
+		"removed or moved (and how far), before the caches are replaced; details the new data is missing,\n"+
+		"such as a URL, are kept from the old caches. It only works with the CSV caches, not -sqldb.\n"+
+		"With -httpCache, downloaded pages are kept and used again for httpTTL, then only downloaded again\n"+
+		"if they have changed; with -offline as well, only the kept pages are used, to re-parse them.\n"+
+		"A -config file can give each dataset's sources, cache, map colour, marker size and a link for\n"+
+		"markers without one, as well as the match rules and outputs; see config.example.json.\n")
 }
 
 func main() {
-	hostelFile := flag.String("hostelFile", "hostels.xml", "xml file of hostels with location data")
+	configFile := flag.String("config", "", "JSON file of datasets, match rules and outputs; flags given as well override it")
+	hostelFile := flag.String("hostelFile", "hostels.xml", "KML, KMZ or GeoJSON file of hostels with location data")
+	hostelFolders := &folderList{folders: []string{yhaFolder}}
+	flag.Var(hostelFolders, "hostelFolders", "KML `folder` to read hostels from; give it more than once for several, or empty for all")
+	niHostelFile := flag.String("niHostelFile", "", "optional KML file of Hostelling International Northern Ireland hostels")
 	waterURL := flag.String("waterfallsURL", "https://en.wikipedia.org/wiki/List_of_waterfalls_of_the_United_Kingdom", "waterfalls data url")
+	waterFile := flag.String("waterfallFile", "", "GeoJSON file of waterfalls to use instead of waterfallsURL")
 	verbose = flag.Bool("v", false, "print verbose output to stderr")
+	workers := flag.Int("workers", 4, "number of Wikipedia pages to crawl concurrently")
+	rate := flag.Duration("rate", 200*time.Millisecond, "minimum time between starting requests to the same host")
+	httpCache := flag.String("httpCache", "", "directory to keep downloaded pages in, to parse again without downloading them")
+	httpTTL := flag.Duration("httpTTL", 24*time.Hour, "how long pages in httpCache are used before checking if they have changed")
+	offline := flag.Bool("offline", false, "only use pages already in httpCache")
 	hostelSave := flag.String("hostelCache", "hostels_cache.csv", "saves hostel data to the file")
 	waterfallSave := flag.String("waterfallCache", "waterfalls_cache.csv", "saves waterfall data to the file")
 	scotlandSave := flag.String("scotlandCache", "scotlands_cache.csv", "saves scottish waterfall data to the file")
 	scotHostelSave := flag.String("scotHostelCache", "scothostels_cache.csv", "saves scottish hostel data to the file")
-	useCache := flag.Bool("use-cache", false, "use the cache rather than File/URL (requires the cache filename flags)")
+	refresh := flag.Bool("refresh", false, "fetch the data again and report what has been added, removed or moved since the cache was saved")
+	refreshReport := flag.String("refreshReport", "", "write the -refresh report to this file rather than stderr")
+	useCache := flag.Bool("use-cache", false, "use the cache rather than File/URL (requires the cache filename flags or a SQL database)")
+	sqlDriver := flag.String("sqldriver", "sqlite3", "SQL driver to use for the cache database (sqlite3 or mysql)")
+	sqlUname := flag.String("sqluname", "", "SQL username")
+	sqlPwd := flag.String("sqlpwd", "", "SQL password for sqluname")
+	sqlDB := flag.String("sqldb", "", "SQL database to cache data in (a filename for sqlite3)")
+
+	export := flag.String("export", "", "also write the markers in these comma separated formats (geojson, kml)")
+	exportDir := flag.String("exportDir", ".", "directory to write exported files to")
 
 	staticImgs := flag.Bool("static", false, "generate static PNGs of maps with markers")
 	mbPage := flag.Bool("mappage", false, "generate webpages with an interactive map")
+	pagesDir := flag.String("pagesDir", "docs", "directory to write the mappage webpages to")
+	distanceName := flag.String("distance", "haversine", "how to measure distances when matching markers and planning itineraries and tours: haversine (on a sphere) or vincenty (on the WGS84 ellipsoid)")
+	osmFile := flag.String("osm", "", "OpenStreetMap .osm.pbf extract to find walking routes in")
+	metric := flag.String("metric", "straight", "how to match waterfalls to the closest hostel: straight, walking (distance) or time (by Naismith's rule); walking and time need -osm")
+	nearestK := flag.Int("k", 1, "number of nearest hostels to list for each waterfall on the map page")
+	radius := flag.Float64("radius", 0, "only list hostels within this many km of each waterfall (0 for no limit)")
+	hostelRadius := flag.Float64("hostelRadius", 0, "also list the waterfalls within this many km of each hostel (0 for none)")
+	gpxFile := flag.String("gpx", "", "write waypoints and routes from each hostel to its closest waterfalls to this GPX file")
+	nights := flag.Int("plan", 0, "plan an itinerary of this many nights (0 for none)")
+	planStart := flag.String("planStart", "", "where the itinerary starts: \"lat,long\" or the name of a hostel")
+	maxDaily := flag.Float64("maxDaily", 30, "furthest in km to travel between hostels each day of the itinerary")
+	walkRange := flag.Float64("walkRange", 5, "furthest in km a waterfall can be from a hostel to visit it")
+	planHTML := flag.String("planHTML", "", "also write the itinerary to this HTML file")
+	planGPX := flag.String("planGPX", "", "also write the itinerary to this GPX file")
+	bboxFlag := flag.String("bbox", "", "only use markers in this box: \"minLong,minLat,maxLong,maxLat\" or uk")
+	nearFlag := flag.String("near", "", "only use markers within a distance of a point: \"lat,long,km\"")
+	regionFile := flag.String("region", "", "only use markers inside the polygons in this GeoJSON file, such as a national park boundary")
+	validateFlag := flag.Bool("validate", false, "check the markers for bad coordinates and duplicates, and print what is wrong to stderr")
+	validRegion := flag.String("validRegion", "uk", "bbox markers must be in to be valid: \"minLong,minLat,maxLong,maxLat\" or uk")
+	dropInvalid := flag.Bool("dropInvalid", false, "leave out markers -validate finds problems with, before they are cached")
+	mergeReportFile := flag.String("mergeReport", "", "write which markers were merged as the same place, and which were kept apart, to this file")
+	tourNames := flag.String("tour", "", "comma separated names of waterfalls (or all) to find a short route to visit")
+	tourStart := flag.String("tourStart", "", "hostel (or \"lat,long\") the tour starts at")
+	tourEnd := flag.String("tourEnd", "", "hostel (or \"lat,long\") the tour ends at")
 	var mboxDs mapboxDetails
 	flag.StringVar(&mboxDs.uname, "mapboxuname", "", "mapbox.com username")
 	flag.StringVar(&mboxDs.style, "mapboxstyle", "", "style of mapbox map")
@@ -69,14 +187,156 @@ func main() {
 	flag.Usage = usage
 	flag.Parse()
 
+	// flags given on the command line override the config file
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	var cfg Config
+	if *configFile != "" {
+		c, err := LoadConfig(*configFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := c.apply(set, flag.Set); err != nil {
+			log.Fatal(err)
+		}
+		cfg = c
+	}
+
+	// an interrupt stops any downloads, and a second one the program
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		signal.Stop(interrupt)
+		cancel()
+	}()
+	fetcher := newFetcher(nil, *rate)
+	if *httpCache != "" {
+		fetcher.cache = diskCache{dir: *httpCache}
+		fetcher.TTL = *httpTTL
+		fetcher.Offline = *offline
+	} else if *offline {
+		log.Fatal("-offline needs an -httpCache to read pages from")
+	}
+
+	if *refresh && *useCache {
+		log.Fatal("-refresh fetches the data again, so can't be used with -use-cache")
+	}
+	if *refresh && *sqlDB != "" {
+		// the report would only be against the CSV caches, not the database
+		log.Fatal("-refresh compares with the CSV caches, so can't be used with -sqldb")
+	}
 	if (*staticImgs || *mbPage) && (mboxDs.uname == "" || mboxDs.style == "" || mboxDs.apikey == "") {
 		log.Fatal("insufficient credentials provided to generate mapbox maps")
 	}
+	dist, ok := geodesy.Distances[*distanceName]
+	if !ok {
+		log.Fatalf("unknown distance %q", *distanceName)
+	}
+	var walk *walkMatcher
+	switch *metric {
+	case "straight":
+	case "walking", "time":
+		if *osmFile == "" {
+			log.Fatalf("-metric %s needs an -osm file", *metric)
+		}
+		fmt.Fprintf(os.Stderr, "Loading walking routes from %s...\n", *osmFile)
+		g, err := routing.Load(*osmFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		walk = &walkMatcher{g: g, byTime: *metric == "time"}
+	default:
+		log.Fatalf("unknown metric %q", *metric)
+	}
+	var regions AllOf
+	if *bboxFlag != "" {
+		b, err := ParseBBox(*bboxFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		regions = append(regions, b)
+	}
+	if *nearFlag != "" {
+		c, err := ParseCircle(*nearFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+		regions = append(regions, c)
+	}
+	if *regionFile != "" {
+		r, err := RegionFromGeoJSON(*regionFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		regions = append(regions, r)
+	}
+	valid, err := ParseBBox(*validRegion)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exports := make(map[string]bool)
+	if *export != "" {
+		for _, format := range strings.Split(*export, ",") {
+			switch format {
+			case "geojson", "kml":
+				exports[format] = true
+			default:
+				log.Fatalf("unknown export format %q", format)
+			}
+		}
+	}
 
 	var hostels, waterfalls, scotlands, scotHostels Markers
-	var err error
+	datasets := map[string]*Markers{
+		"hostels":     &hostels,
+		"waterfalls":  &waterfalls,
+		"scotlands":   &scotlands,
+		"scothostels": &scotHostels,
+	}
+	validateData := func() {
+		if !*validateFlag && !*dropInvalid {
+			return
+		}
+		for _, name := range []string{"hostels", "waterfalls", "scotlands", "scothostels"} {
+			m := datasets[name]
+			v := m.validate(name, valid, duplicateDistance)
+			fmt.Fprint(os.Stderr, v.Summary())
+			if *dropInvalid {
+				*m = m.without(v)
+			}
+		}
+	}
 
-	if *useCache {
+	var db *sql.DB
+	if *sqlDB != "" {
+		db, err = openSQL(*sqlDriver, *sqlUname, *sqlPwd, *sqlDB)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+	}
+
+	if *useCache && db != nil {
+		hostels, err = SQLtoMarkers(db, hostelsTable)
+		if err != nil {
+			log.Fatal(err)
+		}
+		waterfalls, err = SQLtoMarkers(db, waterfallsTable)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scotlands, err = SQLtoMarkers(db, scotlandsTable)
+		if err != nil {
+			log.Fatal(err)
+		}
+		scotHostels, err = SQLtoMarkers(db, scotHostelsTable)
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if *useCache {
 		if *waterfallSave == "" {
 			log.Fatal("Please provide the filename of the waterfall cache")
 		}
@@ -106,19 +366,78 @@ func main() {
 			log.Fatal(err)
 		}
 	} else {
-		fmt.Fprintf(os.Stderr, "Reading hostels XML...\n")
-		hostels = KMLGetLocations(*hostelFile)
-		fmt.Fprintf(os.Stderr, "Crawling waterfalls list webpage...\n")
-		waterfalls = crawlWiki(*waterURL)
-		fmt.Fprintf(os.Stderr, "Parsing list of Scottish waterfalls...\n")
-		scotlands, err = wikiScotlandParse()
-		if err != nil {
-			log.Fatal(err)
+		var sources []SourceConfig
+		if isGeoJSON(*hostelFile) {
+			sources = append(sources, SourceConfig{Type: "geojson", Dataset: "hostels", File: *hostelFile})
+		} else {
+			sources = append(sources, SourceConfig{Type: "kml", Dataset: "hostels", File: *hostelFile, Folders: hostelFolders.folders})
 		}
-		fmt.Fprintf(os.Stderr, "Getting Scottish hostels JSON...\n")
-		scotHostels, err = scottishHostels("https://www.visitscotland.com/tms-api/v1/origins?active=1")
-		if err != nil {
-			log.Fatal(err)
+		if *niHostelFile != "" {
+			sources = append(sources, SourceConfig{Type: "kml", Dataset: "hostels", File: *niHostelFile, Country: "Northern Ireland"})
+		}
+		if *waterFile != "" {
+			sources = append(sources, SourceConfig{Type: "geojson", Dataset: "waterfalls", File: *waterFile})
+		} else {
+			sources = append(sources, SourceConfig{Type: "wikilist", Dataset: "waterfalls", URL: *waterURL})
+		}
+		sources = append(sources,
+			SourceConfig{Type: "wikiscotland", Dataset: "scotlands"},
+			SourceConfig{Type: "visitscotland", Dataset: "scothostels"},
+		)
+
+		sources = cfg.sources(sources, set)
+
+		for _, sc := range sources {
+			dataset, ok := datasets[sc.Dataset]
+			if !ok {
+				log.Fatalf("unknown dataset %q", sc.Dataset)
+			}
+			sc.Workers, sc.Fetcher = *workers, fetcher
+			src, err := NewSource(sc)
+			if err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "Loading %s from %s...\n", sc.Dataset, src.Name())
+			m, err := fetchSource(ctx, src, sc.Country)
+			if err != nil {
+				log.Fatal(err)
+			}
+			dataset.add(m)
+		}
+		for name, m := range datasets {
+			cfg.style(name).link(*m)
+		}
+
+		validateData()
+
+		if *refresh {
+			var report strings.Builder
+			for _, d := range []struct {
+				name  string
+				cache string
+			}{
+				{"hostels", *hostelSave},
+				{"waterfalls", *waterfallSave},
+				{"scotlands", *scotlandSave},
+				{"scothostels", *scotHostelSave},
+			} {
+				old, err := CSVtoMarkers(d.cache)
+				if os.IsNotExist(err) {
+					fmt.Fprintf(os.Stderr, "%s has not been cached before\n", d.name)
+				} else if err != nil {
+					log.Fatal(err)
+				}
+				m := datasets[d.name]
+				report.WriteString(diffMarkers(d.name, old, *m, refreshMoveDistance).Text())
+				*m = mergeRefresh(old, *m)
+			}
+			if *refreshReport != "" {
+				if err := ioutil.WriteFile(*refreshReport, []byte(report.String()), 0644); err != nil {
+					log.Fatal(err)
+				}
+			} else {
+				fmt.Fprint(os.Stderr, report.String())
+			}
 		}
 
 		// save cached data to file
@@ -146,18 +465,158 @@ func main() {
 		} else {
 			fmt.Fprintf(os.Stderr, "saved %d bytes to %s\n", n, *scotHostelSave)
 		}
+
+		if db != nil {
+			for _, t := range []struct {
+				m     Markers
+				table string
+			}{
+				{hostels, hostelsTable},
+				{waterfalls, waterfallsTable},
+				{scotlands, scotlandsTable},
+				{scotHostels, scotHostelsTable},
+			} {
+				n, err := t.m.SaveSQL(db, t.table)
+				if err != nil {
+					log.Println(err)
+				} else {
+					fmt.Fprintf(os.Stderr, "saved %d rows to table %s\n", n, t.table)
+				}
+			}
+		}
+	}
+	if *useCache {
+		for name, m := range datasets {
+			cfg.style(name).link(*m)
+		}
+		validateData()
+	}
+	// the list of UK waterfalls has a Scotland section too,
+	// so merge the Scottish waterfalls which are in it,
+	// and any places listed twice under different names.
+	var decisions []MergeDecision
+	for _, pair := range [][2]*Markers{{&waterfalls, &scotlands}, {&hostels, &scotHostels}} {
+		sets, ds := reconcile([]Markers{*pair[0], *pair[1]}, reconcileDistance, minNameSimilarity)
+		*pair[0], *pair[1] = sets[0], sets[1]
+		decisions = append(decisions, ds...)
+	}
+	if *mergeReportFile != "" {
+		if err := ioutil.WriteFile(*mergeReportFile, []byte(mergeReport(decisions)), 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// the VisitScotland list has hostels all over the world
+	scotHostels = scotHostels.within(ukBounds)
+	if len(regions) > 0 {
+		hostels = hostels.within(regions)
+		waterfalls = waterfalls.within(regions)
+		scotlands = scotlands.within(regions)
+		scotHostels = scotHostels.within(regions)
+		if len(hostels.Markers)+len(waterfalls.Markers)+len(scotlands.Markers)+len(scotHostels.Markers) == 0 {
+			log.Fatal("no markers in the region")
+		}
 	}
+
 	fmt.Fprintf(os.Stderr, "Got %v hostels (and %v in Scotland), %v waterfalls (and %v in Scotland)\n", len(hostels.Markers), len(scotHostels.Markers), len(waterfalls.Markers), len(scotlands.Markers))
 
+	if exports["geojson"] {
+		for _, d := range []struct {
+			m    Markers
+			name string
+		}{
+			{hostels, "hostels"},
+			{waterfalls, "waterfalls"},
+			{scotlands, "scotlands"},
+			{scotHostels, "scothostels"},
+		} {
+			fname := filepath.Join(*exportDir, d.name+".geojson")
+			if err := d.m.SaveGeoJSON(fname); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Fprintf(os.Stderr, "exported %d markers to %s\n", len(d.m.Markers), fname)
+		}
+	}
+	if exports["kml"] {
+		fname := filepath.Join(*exportDir, "holiday-plan.kml")
+		if err := SaveKML(fname, hostels, waterfalls, scotlands, scotHostels, dist, walk); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "exported markers to %s\n", fname)
+	}
+	if *gpxFile != "" {
+		matches := exportMatches(waterfalls, hostels, dist, walk)
+		all := Markers{}
+		for _, m := range []Markers{hostels, waterfalls, scotlands, scotHostels} {
+			all.Markers = append(all.Markers, m.Markers...)
+		}
+		if err := SaveGPX(*gpxFile, all, matches, dist); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d waypoints and %d routes to %s\n", len(all.Markers), len(matches), *gpxFile)
+	}
+
+	// the itinerary and tour go anywhere in the UK
+	allHostels := Markers{Markers: append(append([]Marker(nil), hostels.Markers...), scotHostels.Markers...)}
+	allWaterfalls := Markers{Markers: append(append([]Marker(nil), waterfalls.Markers...), scotlands.Markers...)}
+	if *nights > 0 {
+		if *planStart == "" {
+			log.Fatal("-plan needs -planStart")
+		}
+		start, err := parseStart(*planStart, allHostels)
+		if err != nil {
+			log.Fatal(err)
+		}
+		it := planItinerary(start, allHostels, allWaterfalls, *nights, *maxDaily*1000, *walkRange*1000, dist, walk)
+		fmt.Print(it.Text())
+		if *planHTML != "" {
+			if err := saveItineraryHTML(*planHTML, it); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *planGPX != "" {
+			if err := it.SaveGPX(*planGPX); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	var tour *Tour
+	if *tourNames != "" {
+		stops, err := selectMarkers(allWaterfalls, strings.Split(*tourNames, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		var start, end *Marker
+		if *tourStart != "" {
+			m, err := parseStart(*tourStart, allHostels)
+			if err != nil {
+				log.Fatal(err)
+			}
+			start = &m
+		}
+		if *tourEnd != "" {
+			m, err := parseStart(*tourEnd, allHostels)
+			if err != nil {
+				log.Fatal(err)
+			}
+			end = &m
+		}
+		t := planTour(stops, start, end, dist)
+		tour = &t
+		fmt.Print(tour.Text())
+	}
+
 	if *staticImgs {
+		// the images aren't cached, as their URLs have the api key in
+		mapboxFetcher := newFetcher(nil, *rate)
 		hostelsImg := "map-hostels-" + time.Now().Format("2006-01-02-1504") + ".png"
-		err = MapboxStatic(Markers{Markers: append(hostels.Markers, scotHostels.Markers...)}, hostelsImg, mboxDs)
+		err = MapboxStatic(ctx, mapboxFetcher, Markers{Markers: append(hostels.Markers, scotHostels.Markers...)}, hostelsImg, mboxDs)
 		if err != nil {
 			log.Fatal(err)
 		}
 
 		waterfallsImg := "map-waterfalls-" + time.Now().Format("2006-01-02-1504") + ".png"
-		err = MapboxStatic(Markers{Markers: append(waterfalls.Markers, scotlands.Markers...)}, waterfallsImg, mboxDs)
+		err = MapboxStatic(ctx, mapboxFetcher, Markers{Markers: append(waterfalls.Markers, scotlands.Markers...)}, waterfallsImg, mboxDs)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -166,48 +625,58 @@ func main() {
 	}
 	if *mbPage {
 		// mappage is a fullscreen map; embeddedmappage embeds mappage in an iframe and can have other content too
-		pagesDir := "docs/"
 		mappage := "map.html"
 		embeddedmappage := "index.html"
 
 		// get hostel:waterfalls pairs matched to put in a table
-		matched := matchClosest(waterfalls, hostels)
-		// very hacky, sets all the hostels to be small
-		// then sets the ones closest to waterfalls to be normal size
-		for i := range hostels.Markers {
-			hostels.Markers[i].scale = 0.3
+		matched := matchClosest(waterfalls, hostels, dist, walk)
+		// very hacky, sets all the markers to the size of their dataset
+		// then sets the hostels closest to waterfalls to be normal size
+		for name, m := range datasets {
+			for i := range m.Markers {
+				m.Markers[i].scale = cfg.style(name).Scale
+			}
 		}
-		for h := range matched {
+		for _, h := range matched {
 			for i, hostel := range hostels.Markers {
-				if hostel.Name == h {
+				if hostel.Name == h.Node.Name {
 					hostels.Markers[i].scale = 0.8
 				}
 			}
 		}
-		// don't bother matching the scottish ones -
-		// scotHostels also contains some outside of the UK which messes it up
-		for i := range scotHostels.Markers {
-			scotHostels.Markers[i].scale = 0.3
-		}
 
-		// similarly set all the waterfalls scale
-		for i := range waterfalls.Markers {
-			waterfalls.Markers[i].scale = 0.8
+		// the map is zoomed to the hostels and Scottish waterfalls or,
+		// if a region leaves none of them, to whatever markers there are
+		bounds := Markers{Markers: append(append([]Marker(nil), hostels.Markers...), scotlands.Markers...)}
+		if len(bounds.Markers) == 0 {
+			bounds.Markers = append(append([]Marker(nil), waterfalls.Markers...), scotHostels.Markers...)
 		}
-		for i := range scotlands.Markers {
-			scotlands.Markers[i].scale = 0.4
+		js := mapboxMapJS(mboxDs, formatBounds(bounds, -0.05))
+		js = js + markerToJS(hostels, cfg.style("hostels").Color) + markerToJS(scotHostels, cfg.style("scothostels").Color) +
+			markerToJS(waterfalls, cfg.style("waterfalls").Color) + markerToJS(scotlands, cfg.style("scotlands").Color)
+		if tour != nil {
+			js += routeToJS(tour.Stops, tourColor)
 		}
 
-		js := mapboxMapJS(mboxDs, formatBounds(Markers{Markers: append(hostels.Markers, scotlands.Markers...)}, -0.05))
-		js = js + markerToJS(hostels, "#550000", "https://www.yha.org.uk/hostel/") + markerToJS(scotHostels, "#550000", "") + markerToJS(waterfalls, "#0044ff", "https://en.wikipedia.org/wiki/") + markerToJS(scotlands, "#0055ff", "https://en.wikipedia.org/wiki/")
-
-		err = saveMapboxHTML(pagesDir+mappage, js)
+		err = saveMapboxHTML(filepath.Join(*pagesDir, mappage), js)
 		if err != nil {
 			log.Fatal(err)
 		}
 
-		table := mapToTable(matched, "Hostel", "Closest Waterfalls")
-		err = mapboxEmbeddedPage(pagesDir+embeddedmappage, mappage, table)
+		table := matchesToTable(matched, "Hostel", "Closest Waterfalls")
+		if *nearestK != 1 || *radius > 0 {
+			nearby := matchNearest(waterfalls, hostels, *nearestK, *radius*1000, dist)
+			table += "\n<h3>Hostels near each waterfall</h3>\n" + nearbyToTable(nearby, "Waterfall", "Nearest Hostels")
+		}
+		if *hostelRadius > 0 {
+			nearby := matchNearest(hostels, waterfalls, 0, *hostelRadius*1000, dist)
+			table += fmt.Sprintf("\n<h3>Waterfalls within %g km of each hostel</h3>\n", *hostelRadius) +
+				nearbyToTable(nearby, "Hostel", "Waterfalls")
+		}
+		if tour != nil {
+			table += "\n<h3>Route through the chosen waterfalls</h3>\n" + tourToTable(*tour)
+		}
+		err = mapboxEmbeddedPage(filepath.Join(*pagesDir, embeddedmappage), mappage, table)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -228,100 +697,122 @@ func (m Markers) longestName() (index int, length int) {
 	return
 }
 
-// CSVtoMarkers takes the name of a CSV file and returns a Markers.
-// The CSV may have been produced by Markers.SaveCSV:
-// the file has three fields: name, lat, long.
-func CSVtoMarkers(fname string) (Markers, error) {
-	f, err := os.Open(fname)
+// MakeWikiURL takes a formatted Wikipedia pagename (ie spaces are underscores)
+// and adds the English Wikipedia prefix.
+func MakeWikiURL(pagename string) string {
+	return wikiPrefix + pagename
+}
+
+// crawlWiki gets the list of waterfalls at listURL and finds each
+// waterfall's location using the MediaWiki API.
+// The pages the API has no coordinates for are crawled
+// workers pages at a time and their wikitext is parsed instead.
+// Each Marker's Country is the section of the list it was in,
+// and its Source is listURL.
+func crawlWiki(ctx context.Context, f *Fetcher, listURL string, workers int) (Markers, error) {
+	lines, err := GetWikiText(ctx, f, listURL)
 	if err != nil {
 		return Markers{}, err
 	}
-	defer f.Close()
-	r := csv.NewReader(f)
-	lines, err := r.ReadAll()
+
+	listed := parseWaterfallList(lines)
+	waterfalls := make([]string, len(listed))
+	for i, l := range listed {
+		waterfalls[i] = l.page
+	}
+
+	fmt.Fprintf(os.Stderr, "Parsed list page, looking up coordinates...\n")
+
+	found, missing, err := APICoordinates(ctx, f, wikiAPI, waterfalls)
 	if err != nil {
-		return Markers{}, err
+		if ctx.Err() != nil {
+			return Markers{}, ctx.Err()
+		}
+		log.Printf("MediaWiki API: %v; falling back to wikitext\n", err)
+		found, missing = Markers{}, waterfalls
 	}
-	m := Markers{make([]Marker, len(lines))}
-	for i, line := range lines {
-		m.Markers[i].Name = line[0]
-		m.Markers[i].Lat, err = strconv.ParseFloat(line[1], 64)
-		m.Markers[i].Long, _ = strconv.ParseFloat(line[2], 64)
+	var crawled Markers
+	if len(missing) != 0 {
+		fmt.Fprintf(os.Stderr, "Following %d links without coordinates from the API...\n", len(missing))
+		crawled = crawlPages(ctx, f, missing, workers)
 	}
 
-	return m, err
+	// put them back in the same order as the list
+	byName := make(map[string]Marker)
+	for _, m := range append(found.Markers, crawled.Markers...) {
+		byName[m.Name] = m
+	}
+	formatted := Markers{Source: listURL, Fetched: time.Now()}
+	for _, l := range listed {
+		if m, ok := byName[strings.ReplaceAll(l.page, "_", " ")]; ok {
+			m.Kind = KindWaterfall
+			m.Country = l.country
+			m.Source = listURL
+			formatted.Markers = append(formatted.Markers, m)
+		}
+	}
+	return formatted, nil
 }
 
-// MakeWikiURL takes a formatted Wikipedia pagename (ie spaces are underscores)
-// and adds the English Wikipedia prefix.
-func MakeWikiURL(pagename string) string {
-	return "https://en.wikipedia.org/wiki/" + pagename
+// listedPage is a page linked to from a list of places,
+// with the country whose section of the list it is in.
+type listedPage struct {
+	page    string
+	country string
 }
 
-func crawlWiki(listURL string) Markers {
-	lines, err := GetWikiText(listURL)
-	if err != nil {
-		log.Panic(err)
-	}
-
-	var waterfalls []string
+// parseWaterfallList returns the pagenames linked to in each of the
+// country sections of the list of waterfalls.
+// The first link on each line is the waterfall.
+func parseWaterfallList(lines []string) []listedPage {
+	var waterfalls []listedPage
 	var inSection string = ""
 	for _, line := range lines {
 		if len(strings.TrimSpace(line)) == 0 {
 			inSection = ""
 		}
-		// We're not going to Northern Ireland this year,
-		// and the Scotland waterfall links are messed up. TBC
-		if inSection == "Scotland" || inSection == "Northern_Ireland" {
-			continue
-		}
-		if inSection != "" {
-			// the data are in a table so the first character is a '*'
+		// the data are in a list so the first character is a '*'
+		if inSection != "" && strings.HasPrefix(line, "*") {
 			link, err := ParseXWikiLinks(line[1:])
 			if err != nil {
 				continue
 			}
-			waterfalls = append(waterfalls, link)
+			waterfalls = append(waterfalls, listedPage{link, inSection})
 		}
-		// country headers are links surrounded by "==="
-		if strings.Contains(line, "===") {
-			inSection, _ = ParseXWikiLinks(line)
+		// country headers are surrounded by "===", and are usually links
+		if strings.HasPrefix(line, "===") {
+			inSection = sectionTitle(line)
 		}
 	}
+	return waterfalls
+}
 
-	fmt.Fprintf(os.Stderr, "Parsed list page, following links...\n")
-
-	var formatted Markers
-	for _, f := range waterfalls {
-		//fmt.Println(f)
-		mark, err := GetLocationFromWikiPage(f)
-		if err != nil {
-			if *verbose {
-				fmt.Fprintf(os.Stderr, "%s: %v\n", f, err)
-			}
-		} else {
-			formatted.Markers = append(formatted.Markers, mark)
-		}
+// sectionTitle returns the title of a wikitext section header like
+// "===[[Northern Ireland]]===" with any link removed, ie "Northern Ireland".
+func sectionTitle(line string) string {
+	title := strings.Trim(strings.TrimSpace(line), "=")
+	if link, err := ParseXWikiLinks(title); err == nil {
+		title = link
 	}
-
-	return formatted
+	return strings.TrimSpace(strings.ReplaceAll(title, "_", " "))
 }
 
 // GetWikiText takes the url of a normal Wikipedia page
 // and returns the lines in text/x-wiki format.
 // It follows redirects and says so by printing to Stderr.
-func GetWikiText(url string) ([]string, error) {
-	page, err := http.Get(url + "?action=raw")
+func GetWikiText(ctx context.Context, f *Fetcher, url string) ([]string, error) {
+	lines, _, err := getWikiPage(ctx, f, url)
+	return lines, err
+}
+
+// getWikiPage is like GetWikiText but also returns the url of the page
+// the lines are from, which is different if there was a redirect.
+func getWikiPage(ctx context.Context, f *Fetcher, url string) ([]string, string, error) {
+	pageBytes, err := f.Get(ctx, url+"?action=raw")
 	if err != nil {
-		return []string{""}, err
+		return []string{""}, url, err
 	}
-	defer page.Body.Close()
-	if page.StatusCode == 404 {
-		// when 404, page.Status should be "404 Not Found"
-		return []string{""}, errors.New(page.Status)
-	}
-	pageBytes, _ := ioutil.ReadAll(page.Body)
-	lines := strings.Split(fmt.Sprintf("%s", pageBytes), "\n")
+	lines := strings.Split(string(pageBytes), "\n")
 
 	// check if it is a redirect page, and if so, follow it:
 	if strings.Contains(lines[0], "REDIRECT") || strings.Contains(lines[0], "redirect") {
@@ -329,101 +820,36 @@ func GetWikiText(url string) ([]string, error) {
 		if *verbose {
 			fmt.Fprintf(os.Stderr, "%s :  redirecting to %s\n", url, redirectURL)
 		}
-		return GetWikiText(MakeWikiURL(redirectURL))
+		return getWikiPage(ctx, f, MakeWikiURL(redirectURL))
 	}
-	return lines, err
+	return lines, url, nil
 }
 
 // GetLocationFromWikiPage takes a Wikipedia page name, and returns
 // a Marker with the pagename as a Name and the location from a {{coord}}
-// tag in the Wikitext.
+// template (or infobox) in the Wikitext, found using ParseCoordinates.
 // The location data is converted to decimal form if necessary.
-func GetLocationFromWikiPage(wikiURL string) (Marker, error) {
-	lines, err := GetWikiText(MakeWikiURL(wikiURL))
+// The Marker's URL is the page the location was found on,
+// and its Attrs are from the infobox, if there is one.
+func GetLocationFromWikiPage(ctx context.Context, f *Fetcher, wikiURL string) (Marker, error) {
+	lines, url, err := getWikiPage(ctx, f, MakeWikiURL(wikiURL))
 	if err != nil {
 		return Marker{}, err
 	}
-	var coord string
-	for _, line := range lines {
-		if strings.Contains(line, "{{coord") || strings.Contains(line, "{{Coord") {
-			// check that there is coord data, not just an empty tag
-			if strings.Contains(line, "oord}}") {
-				continue
-			}
-			coord = line
-			break
-		}
-	}
-	if coord == "" {
-		/*for _, line := range lines {
-			fmt.Println(line)
-		}*/
-		return Marker{}, errors.New("No location found")
-	}
-
-	var lat, long float64
-	// now we need to extract the location from the coord string, and convert
-	// it if necessary to decimal format.
-	// firstly, get rid of the "{{coord|" bit (the coordinate starts after it)
-	begIndex := strings.Index(coord, "{{coord|")
-	if begIndex == -1 {
-		begIndex = strings.Index(coord, "{{Coord|")
-	}
-	// The + 1 in these next two account for the extra space.
-	// Really, any amount of whitespace should be checked for.
-	if begIndex == -1 {
-		begIndex = strings.Index(coord, "{{coord |") + 1
-	}
-	if begIndex == -1 {
-		begIndex = strings.Index(coord, "{{Coord |") + 1
-	}
-	coord = coord[begIndex+8:]
-	// remove any leading "|" s, since they'll mess up the splitting bit
-	for coord[0] == '|' {
-		coord = coord[1:]
-	}
-	// locations in the degree, minute, second format contain a "|N|" or "|S|" and "|W" or "|E"
-	// (for the W and E it's possible not to have a final pipe since they come last,
-	// so if there's no extra info afterwards there might be a }} rather than |.)
-	if strings.Contains(coord, "|N|") || strings.Contains(coord, "|S|") {
-		var n_or_s string
-		if strings.Contains(coord, "|N|") {
-			n_or_s = "|N|"
-		} else {
-			n_or_s = "|S|"
-		}
-		latS := coord[:strings.Index(coord, n_or_s)]
-		lat = DmsToDec(latS)
-
-		var w_or_e string
-		if strings.Contains(coord, "|W") {
-			w_or_e = "|W"
-		} else {
-			w_or_e = "|E"
-		}
-		longS := coord[strings.Index(coord, n_or_s)+3 : strings.Index(coord, w_or_e)]
-		long = DmsToDec(longS)
-
-		// correct for west and south coords begin negative in decimal
-		if w_or_e == "|W" {
-			long = -long
-		}
-		if n_or_s == "|S|" {
-			lat = -lat
-		}
-	} else {
-		// otherwise, the data are already in decimal format
-		split_coords := strings.Split(coord, "|")
-		lat, _ = strconv.ParseFloat(strings.TrimSpace(split_coords[0]), 64)
-		long, _ = strconv.ParseFloat(strings.TrimSpace(split_coords[1]), 64)
+	text := strings.Join(lines, "\n")
+	lat, long, err := ParseCoordinates(text)
+	if err != nil {
+		return Marker{}, err
 	}
 
 	// to make the marker name look nice, change the underscores back to spaces
 	name := strings.ReplaceAll(wikiURL, "_", " ")
 	return Marker{
-		Name: name,
-		Lat:  lat,
-		Long: long,
+		Name:  name,
+		Lat:   lat,
+		Long:  long,
+		URL:   url,
+		Attrs: InfoboxAttrs(text),
 	}, nil
 }
 
@@ -473,49 +899,85 @@ func ParseXWikiLinks(s string) (string, error) {
 	return s, nil
 }
 
-// KMLGetLocations extracts location data from an xml file.
-func KMLGetLocations(filename string) Markers {
-	hFile, err := os.Open(filename)
-	if err != nil {
-		log.Fatal(err)
+// KMLGetLocations reads the hostels in a KML or KMZ file.
+// Only the Placemarks in the named folders (at any depth) are read,
+// or all of them if no folders are given.
+// The Markers have the filename as their Source and the name of
+// the folder each hostel is in as its "category" Attr.
+// Placemarks which can't be read are skipped and printed to stderr.
+// Each Marker's URL is the Placemark's link, if it has one.
+func KMLGetLocations(filename string, folders ...string) (Markers, error) {
+	places, err := kml.ReadFile(filename)
+	var skipped kml.SkippedError
+	if errors.As(err, &skipped) {
+		for _, pm := range skipped {
+			fmt.Fprintf(os.Stderr, "%s: skipping %v\n", filename, pm)
+		}
+	} else if err != nil {
+		return Markers{}, err
 	}
-	defer hFile.Close()
-
-	hostelBytes, _ := ioutil.ReadAll(hFile)
 
-	var hostels Kml
-	if err := xml.Unmarshal([]byte(hostelBytes), &hostels); err != nil {
-		log.Fatal(err)
+	m := Markers{Source: filename, Fetched: time.Now()}
+	for _, p := range places {
+		if len(folders) > 0 && !p.InFolder(folders...) {
+			continue
+		}
+		mark := Marker{
+			Name:   p.Name,
+			Lat:    p.Lat,
+			Long:   p.Long,
+			Kind:   KindHostel,
+			URL:    p.URL,
+			Source: filename,
+		}
+		if c := p.Category(); c != "" {
+			mark.Attrs = map[string]string{"category": c}
+		}
+		m.Markers = append(m.Markers, mark)
 	}
-
-	// the first element in Folders in this case is YHA hostels.
-	// Other elements are either retired or independent, and negligible.
-
-	n := len(hostels.Documents.Folders[0].Placemarks)
-	formatted := make([]Marker, n)
-	for i, place := range hostels.Documents.Folders[0].Placemarks {
-		formatted[i].Name = place.Name
-		gps := strings.Split(place.Point.Coords, ",")
-		formatted[i].Long, _ = strconv.ParseFloat(gps[0], 64)
-		formatted[i].Lat, _ = strconv.ParseFloat(gps[1], 64)
+	if len(m.Markers) == 0 && len(places) > 0 {
+		return m, fmt.Errorf("%s: no placemarks in folders %q", filename, folders)
 	}
-
-	return Markers{Markers: formatted}
+	return m, nil
 }
 
 // Markers wraps a slice of type Marker
 type Markers struct {
 	Markers []Marker
+	// Source is the file or URL the Markers were fetched from, if known.
+	Source string
+	// Fetched is when the Markers were fetched from Source, if known.
+	Fetched time.Time
 }
 
 // Marker is a basic point with a name and a location expressed in decimal coordinates
 type Marker struct {
-	Name  string
-	Lat   float64
-	Long  float64
+	Name string
+	Lat  float64
+	Long float64
+	// Kind is what sort of place the Marker is.
+	Kind Kind
+	// Country is the part of the UK the Marker is in, if known.
+	Country string
+	// URL is the canonical web page about the place, if known.
+	URL string
+	// Source is the file or URL of the dataset the Marker came from.
+	Source string
+	// Attrs holds any other information known about the place,
+	// such as "height", "river", "gridref" or "capacity".
+	Attrs map[string]string
 	scale float64
 }
 
+// Kind is the sort of place a Marker is.
+type Kind string
+
+const (
+	KindHostel    Kind = "hostel"
+	KindWaterfall Kind = "waterfall"
+	KindOther     Kind = "other"
+)
+
 // FindRanges returns the index of the Marker with the largest or smallest
 // Lat or Long. The arguments it takes are bools:
 // when lat is true, the Lats are searched;
@@ -548,55 +1010,3 @@ func (m Markers) FindRanges(lat bool, max bool) int {
 	}
 	return maxIndex
 }
-
-// SaveCSV saves a Markers to a file in CSV format,
-// with each line of the CSV having 3 fields, delimited by commas,
-// representing Markers[i].Name, Lat, Long respectively.
-// The first field (Name) is surrounded by double quotes (" ").
-// The number of bytes written and an error is returned.
-// if the filename provided already exists, an error is returned.
-func (m Markers) SaveCSV(filename string) (int, error) {
-	f, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
-	if err != nil {
-		return 0, err
-	}
-	defer f.Close()
-
-	var bytesWritten int
-	for _, mark := range m.Markers {
-		n, err := fmt.Fprintln(f, fmt.Sprintf("\"%s\",%f,%f", mark.Name, mark.Lat, mark.Long))
-		if err != nil {
-			return bytesWritten, nil
-		}
-		bytesWritten += n
-	}
-
-	return bytesWritten, err
-}
-
-// Kml provides the highest level of tags in a KML-type XML file
-// which are relevant for finding location data.
-type Kml struct {
-	XMLName   xml.Name `xml:"kml"`
-	Documents Document `xml:"Document"`
-}
-
-type Document struct {
-	XMLName xml.Name `xml:"Document"`
-	Folders []Folder `xml:"Folder"`
-}
-
-type Folder struct {
-	XMLName    xml.Name    `xml:"Folder"`
-	Name       string      `xml:"name"`
-	Placemarks []Placemark `xml:"Placemark"`
-}
-
-type Placemark struct {
-	Name  string `xml:"name"`
-	Point Coord  `xml:"Point"`
-}
-
-type Coord struct {
-	Coords string `xml:"coordinates"`
-}
@@ -5,7 +5,12 @@
 
 package main
 
-import "testing"
+import (
+	"flag"
+	"testing"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
 
 func TestDmsToDec(t *testing.T) {
 	dms := "50|30"
@@ -51,3 +56,105 @@ func TestFindRanges(t *testing.T) {
 		t.Errorf("longMin = %v, wanted 2", longMin)
 	}
 }
+
+func TestFormatBounds(t *testing.T) {
+	m := Markers{Markers: []Marker{{Lat: 50, Long: -4}, {Lat: 54, Long: -2}}}
+	if got, want := formatBounds(m, 0.5), "[-5.000000,48.000000,-1.000000,56.000000]"; got != want {
+		t.Errorf("formatBounds = %s; wanted %s", got, want)
+	}
+	// a region can leave no markers
+	if got, want := formatBounds(Markers{}, 0), "[-8.700000,49.800000,1.800000,61.000000]"; got != want {
+		t.Errorf("formatBounds of no markers = %s; wanted the UK's, %s", got, want)
+	}
+}
+
+func TestKMLGetLocations(t *testing.T) {
+	yha, err := KMLGetLocations("hostels.xml", yhaFolder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := KMLGetLocations("hostels.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(yha.Markers) == 0 || len(all.Markers) <= len(yha.Markers) {
+		t.Fatalf("read %d YHA hostels out of %d; wanted some but not all", len(yha.Markers), len(all.Markers))
+	}
+	first := yha.Markers[0]
+	if first.Name != "Alstonefield" || first.Kind != KindHostel || first.Attrs["category"] != yhaFolder {
+		t.Errorf("first hostel = %+v; wanted Alstonefield in %q", first, yhaFolder)
+	}
+	if _, err := KMLGetLocations("hostels.xml", "no such folder"); err == nil {
+		t.Error("reading a missing folder succeeded; wanted an error")
+	}
+
+	// a folder with a comma in its name, given as a flag
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	folders := &folderList{folders: []string{yhaFolder}}
+	fs.Var(folders, "hostelFolders", "")
+	other := "Other hostels, including former ones"
+	if err := fs.Parse([]string{"-hostelFolders", other, "-hostelFolders", "Independent hostels"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(folders.folders) != 2 || folders.folders[0] != other {
+		t.Fatalf("folders = %q; wanted %q and Independent hostels", folders.folders, other)
+	}
+	some, err := KMLGetLocations("hostels.xml", folders.folders...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, h := range some.Markers {
+		if c := h.Attrs["category"]; c != other && c != "Independent hostels" {
+			t.Errorf("read %s from %q", h.Name, c)
+		}
+	}
+	if len(some.Markers) == 0 {
+		t.Error("read no hostels from the folders")
+	}
+}
+
+func TestMatchNearest(t *testing.T) {
+	hostels := Markers{Markers: []Marker{
+		{Name: "Langdon Beck", Lat: 54.6755, Long: -2.2358},
+		{Name: "Edale", Lat: 53.376148, Long: -1.791024},
+		{Name: "Alston", Lat: 54.808934, Long: -2.441886},
+	}}
+	waterfalls := Markers{Markers: []Marker{
+		{Name: "High Force", Lat: 54.6503, Long: -2.1856},
+		{Name: "Kinder Downfall", Lat: 53.3990, Long: -1.8750},
+	}}
+
+	got := matchNearest(waterfalls, hostels, 2, 0, geodesy.Haversine)
+	if len(got) != 2 {
+		t.Fatalf("got %d Nearbys; wanted one for each waterfall", len(got))
+	}
+	var names []string
+	for _, n := range got[0].Neighbours {
+		names = append(names, n.Name)
+	}
+	if len(names) != 2 || names[0] != "Langdon Beck" || names[1] != "Alston" {
+		t.Errorf("nearest 2 hostels to High Force = %q; wanted Langdon Beck, Alston", names)
+	}
+	if d := got[0].Neighbours[0].Distance; d < 4000 || d > 5000 {
+		t.Errorf("High Force is %.0f m from Langdon Beck; wanted about 4.3 km", d)
+	}
+
+	// within 10 km of each hostel
+	got = matchNearest(hostels, waterfalls, 0, 10000, geodesy.Haversine)
+	for i, want := range []int{1, 1, 0} {
+		if len(got[i].Neighbours) != want {
+			t.Errorf("%s has %d waterfalls within 10 km; wanted %d", got[i].Marker.Name, len(got[i].Neighbours), want)
+		}
+	}
+}
+
+func TestDistanceBn(t *testing.T) {
+	london := Marker{Lat: 51.5074, Long: -0.1278}
+	sydney := Marker{Lat: -33.8688, Long: 151.2093}
+	for name, f := range geodesy.Distances {
+		// more than 90° apart, which distanceBn used to get wrong
+		if d := distanceBn(f, london, sydney); d < 16.9e6 || d > 17.1e6 {
+			t.Errorf("%s: London to Sydney = %.0f m; wanted about 17000 km", name, d)
+		}
+	}
+}
@@ -6,10 +6,11 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
-	"os"
+	"net/url"
 )
 
 type mapboxDetails struct {
@@ -20,7 +21,7 @@ type mapboxDetails struct {
 
 // MapboxStatic creates a static image of a map
 // with markers represented by m
-func MapboxStatic(m Markers, fname string, mbox mapboxDetails) error {
+func MapboxStatic(ctx context.Context, f *Fetcher, m Markers, fname string, mbox mapboxDetails) error {
 	baseURL := "https://api.mapbox.com/"
 	query := fmt.Sprintf("styles/v1/%s/%s/static/", mbox.uname, mbox.style)
 	// it is possible to just use "auto" instead of a bbox for this next field
@@ -36,26 +37,42 @@ func MapboxStatic(m Markers, fname string, mbox mapboxDetails) error {
 	for _, mark := range m.Markers {
 		markersMapbox += markerToMapbox(mark, "", "") + ","
 	}
-	// remove the final comma
-	markersMapbox = markersMapbox[:len(markersMapbox)-1]
+	if markersMapbox != "" {
+		// remove the final comma
+		markersMapbox = markersMapbox[:len(markersMapbox)-1]
+	} else {
+		// the map without the markers overlay
+		suffix = suffix[1:]
+	}
 
-	imgP, err := http.Get(baseURL + query + markersMapbox + suffix + mbox.apikey)
-	//fmt.Printf("GET: %s\n", baseURL+query+markersMapbox+suffix+mbox.apikey)
+	bytes, err := f.Get(ctx, baseURL+query+markersMapbox+suffix+mbox.apikey)
 	if err != nil {
+		// the errors have the URL in, so don't print the api key
+		var serr *StatusError
+		var uerr *url.Error
+		switch {
+		case errors.As(err, &serr):
+			return fmt.Errorf("mapbox static image: %s", serr.Status)
+		case errors.As(err, &uerr):
+			return fmt.Errorf("mapbox static image: %v", uerr.Err)
+		}
 		return err
 	}
-	defer imgP.Body.Close()
-	bytes, _ := ioutil.ReadAll(imgP.Body)
-	f, err := os.Create(fname)
-	f.Write(bytes)
-	return err
+	return ioutil.WriteFile(fname, bytes, 0644)
 }
 
 // formatBounds makes a bbox given a Markers
 // in the order min(long), min(lat), max(long), max(lat)
 // with optional spacing as a fraction of the width/height.
 // the spacing can be negative to zoom in.
+// If there are no Markers, it is the bbox of the UK.
 func formatBounds(m Markers, space float64) string {
+	if len(m.Markers) == 0 {
+		m.Markers = []Marker{
+			{Lat: ukBounds.MinLat, Long: ukBounds.MinLong},
+			{Lat: ukBounds.MaxLat, Long: ukBounds.MaxLong},
+		}
+	}
 	left := m.Markers[m.FindRanges(false, false)].Long
 	bot := m.Markers[m.FindRanges(true, false)].Lat
 	right := m.Markers[m.FindRanges(false, true)].Long
@@ -6,74 +6,91 @@
 package main
 
 import (
-	"math"
+	"sort"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
 )
 
-// matchClosest matches each child to its closest node
-func matchClosest(childs, nodes Markers) map[string][]string {
-	var matched = make(map[string][]string)
-	for _, node := range nodes.Markers {
-		matched[node.Name] = []string{}
+// duplicateDistance is how close (in meters) two Markers must be
+// to be taken as the same place by reconcile when they are in different
+// lists and their names are only a little alike.
+const duplicateDistance = 200
+
+// Match is a node and the childs which were matched to it.
+type Match struct {
+	Node   Marker
+	Childs []Marker
+}
+
+// matchClosest matches each child to its closest node,
+// in a straight line measured by dist or, if walk isn't nil, by walking.
+// Only the nodes which have been matched to are returned,
+// sorted by name.
+func matchClosest(childs, nodes Markers, dist geodesy.Distance, walk *walkMatcher) []Match {
+	if len(nodes.Markers) == 0 {
+		return nil
 	}
+	matched := make([][]Marker, len(nodes.Markers))
+	tree := newKDTree(nodes, dist)
 	for _, child := range childs.Markers {
-		closestNode := nodes.sortClosest(child).Name
-		matched[closestNode] = append(matched[closestNode], child.Name)
+		var i int
+		if walk != nil {
+			i = walk.closestIndex(child, nodes, tree)
+		} else {
+			i = tree.nearestIndex(child)
+		}
+		matched[i] = append(matched[i], child)
 	}
-	// now delete all the entries which weren't filled
-	for key := range matched {
-		if len(matched[key]) == 0 {
-			delete(matched, key)
+	// now leave out all the nodes which weren't matched to
+	var matches []Match
+	for i, m := range matched {
+		if len(m) != 0 {
+			matches = append(matches, Match{Node: nodes.Markers[i], Childs: m})
 		}
 	}
-	return matched
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Node.Name < matches[j].Node.Name })
+	return matches
 }
 
-// sortClosest returns the nearest m.Marker to n
-func (m Markers) sortClosest(n Marker) Marker {
-	var closest Marker = m.Markers[0]
-	var mdist float64 = distanceBn(m.Markers[0], n)
-	for _, mark := range m.Markers {
-		if d := distanceBn(mark, n); d < mdist {
-			mdist = d
-			closest = mark
-		}
+// exportMatches matches the waterfalls to the hostels for the KML
+// and GPX exports. As on the map pages, the Scottish sets aren't
+// matched: scotHostels also has hostels outside the UK.
+func exportMatches(waterfalls, hostels Markers, dist geodesy.Distance, walk *walkMatcher) []Match {
+	return matchClosest(waterfalls, hostels, dist, walk)
+}
+
+// Neighbour is a Marker and its distance in meters from another Marker.
+type Neighbour struct {
+	Marker
+	Distance float64
+}
+
+// Nearby is a Marker and its Neighbours, nearest first.
+type Nearby struct {
+	Marker     Marker
+	Neighbours []Neighbour
+}
+
+// matchNearest finds the Neighbours in nodes of each of childs,
+// nearest first by dist, and at most k of them within radius meters.
+// If k or radius is not positive, it is not a limit.
+// With k = 1 and no radius, this is a view of matchClosest from the childs' side.
+// The result is in the same order as childs.
+func matchNearest(childs, nodes Markers, k int, radius float64, dist geodesy.Distance) []Nearby {
+	nearby := make([]Nearby, len(childs.Markers))
+	tree := newKDTree(nodes, dist)
+	for i, child := range childs.Markers {
+		nearby[i] = Nearby{Marker: child, Neighbours: tree.search(child, k, radius)}
 	}
-	return closest
+	return nearby
 }
 
-func distanceBn(m1, m2 Marker) float64 {
-	// in meters
-	earthR := 6371.009e3
-	// convert to radians
-	lat1 := m1.Lat * math.Pi / 180
-	long1 := m1.Long * math.Pi / 180
-	lat2 := m2.Lat * math.Pi / 180
-	long2 := m2.Long * math.Pi / 180
-	// special case of the Vicenty formula; obtained from https://en.wikipedia.org/wiki/Great-circle_distance
-	deltaLong := long2 - long1
-	centralAng := math.Atan(
-		math.Sqrt(
-			math.Pow(math.Cos(lat2)*math.Sin(deltaLong), 2)+
-				math.Pow(math.Cos(lat1)*math.Sin(lat2)-
-					math.Sin(lat1)*math.Cos(lat2)*math.Cos(deltaLong), 2)) /
-			(math.Sin(lat1)*math.Sin(lat2) +
-				math.Cos(lat1)*math.Cos(lat2)*math.Cos(deltaLong)))
-	return earthR * centralAng
+// distanceBn returns the distance in meters between m1 and m2, measured by dist.
+func distanceBn(dist geodesy.Distance, m1, m2 Marker) float64 {
+	return dist(m1.point(), m2.point())
 }
 
-func simplerDistanceBn(m1, m2 Marker) float64 {
-	// in meters
-	earthR := 6371.009e3
-	// convert to radians
-	lat1 := m1.Lat * math.Pi / 180
-	long1 := m1.Long * math.Pi / 180
-	lat2 := m2.Lat * math.Pi / 180
-	long2 := m2.Long * math.Pi / 180
-	// obtained from https://en.wikipedia.org/wiki/Great-circle_distance
-	deltaLat := lat2 - lat1
-	deltaLong := long2 - long1
-	centralAng := 2 * math.Asin(math.Sqrt(
-		math.Pow(math.Sin(deltaLat/2), 2)+
-			math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(deltaLong/2), 2)))
-	return earthR * centralAng
+// point returns the position of m for the geodesy package.
+func (m Marker) point() geodesy.Point {
+	return geodesy.Point{Lat: m.Lat, Long: m.Long}
 }
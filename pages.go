@@ -7,8 +7,8 @@ package main
 
 import (
 	"fmt"
+	"html"
 	"os"
-	"sort"
 	"strings"
 )
 
@@ -167,7 +167,7 @@ License: CC-BY 4.0 -->
 <h1>Map of Waterfalls in the UK</h1>
 <h2>And hostels close to them</h2>
 <p>
-The map below shows waterfalls with blue markers and hostels with brown markers. Markers for waterfalls in Scotland are smaller and slightly lighter so they can be more easily seen.
+The map below shows waterfalls in England, Scotland, Wales and Northern Ireland with blue markers and hostels with brown markers. Markers for the extra waterfalls from the list of Scottish waterfalls are smaller and slightly lighter so they can be more easily seen.
 
 Click on any marker to show its name and a link.
 
@@ -175,6 +175,7 @@ All the YHA hostels in England and Wales are shown, and the hostels which are cl
 Hostels in Scotland are also shown, but they do not have links.
 
 Underneath there is a table showing for each waterfall which hostel is nearest, again with links.
+There may also be tables of the hostels near each waterfall, and of the waterfalls near each hostel, with their distances.
 </p>
 <center>
 <iframe name="map" id="map" allowfullscreen="" src=` + fmt.Sprintf("%q", mapURL) + ` height="500" width="500" style="max-width:100%;"></iframe>
@@ -201,79 +202,182 @@ Copyright © Ben Fuller, 2021
 	return err
 }
 
-// mapToTable takes a map[string][]string and turns it into a html table
-// sorted by the key.
-// headers must have two elements; one to head the keys and one the values.
-func mapToTable(m map[string][]string, headers ...interface{}) string {
-	// sort the keys
-	keys := make([]string, 0, len(m))
-	for k := range m {
-		keys = append(keys, k)
+// matchesToTable turns the Matches into a html table,
+// with a row for each Match.
+// headers must have two elements; one to head the nodes and one the childs.
+func matchesToTable(matches []Match, headers ...interface{}) string {
+	var tableBody string
+	for _, m := range matches {
+		if len(m.Childs) == 0 {
+			continue
+		}
+		childLinks := []string{}
+		for _, c := range m.Childs {
+			childLinks = append(childLinks, markerLink(c))
+		}
+		tableBody += fmt.Sprintf("<tr><td>%s</td><td>%s</td></tr>\n", markerLink(m.Node), strings.Join(childLinks, "<br>"))
 	}
-	sort.Strings(keys)
 
+	return fmt.Sprintf("<table id=\"table\">\n<tr><th>%s</th><th>%s</th></tr>\n", headers...) + tableBody + "</table>"
+}
+
+// nearbyToTable turns the Nearbys into a html table, with a row for each
+// Marker which has Neighbours, listing them with their distances in km.
+// headers must have two elements; one to head the Markers and one the Neighbours.
+func nearbyToTable(nearby []Nearby, headers ...interface{}) string {
 	var tableBody string
-	for _, k := range keys {
-		if len(m[k]) == 0 {
+	for _, n := range nearby {
+		if len(n.Neighbours) == 0 {
 			continue
 		}
-		// this bit making the link is a bit rough and some place names won't work
-		// but it's easier to manually fix broken links later in the html
-		linkslice := strings.Split(k, " ")
-		if len(linkslice) > 3 {
-			linkslice = linkslice[:2]
+		links := []string{}
+		for _, nb := range n.Neighbours {
+			links = append(links, fmt.Sprintf("%s (%.1f km)", markerLink(nb.Marker), nb.Distance/1000))
 		}
-		link := strings.Join(linkslice, "-")
-		// remove commas and apostrophes
-		link = strings.ReplaceAll(link, ",", "")
-		link = strings.ReplaceAll(link, "'", "")
-		waterfallsLinks := []string{}
-		for _, w := range m[k] {
-			waterfallsLinks = append(waterfallsLinks, "<a href=\"https://en.wikipedia.org/wiki/"+strings.ReplaceAll(w, " ", "_")+"\">"+w+"</a>")
+		tableBody += fmt.Sprintf("<tr><td>%s</td><td>%s</td></tr>\n", markerLink(n.Marker), strings.Join(links, "<br>"))
+	}
+
+	return fmt.Sprintf("<table>\n<tr><th>%s</th><th>%s</th></tr>\n", headers...) + tableBody + "</table>"
+}
+
+// itineraryToTable turns the Itinerary into a html table,
+// with a row for each night.
+func itineraryToTable(it Itinerary) string {
+	var tableBody string
+	for i, s := range it.Stays {
+		links := []string{}
+		for _, w := range s.Waterfalls {
+			links = append(links, fmt.Sprintf("%s (%.1f km)", markerLink(w.Marker), w.Distance/1000))
 		}
-		tableBody += fmt.Sprintf("<tr><td><a href=\"https://www.yha.org.uk/hostel/%s\">%s</a></td><td>%s</td></tr>\n", link, k, strings.Join(waterfallsLinks, "<br>"))
+		tableBody += fmt.Sprintf("<tr><td>%d</td><td>%s</td><td>%.1f km</td><td>%s</td></tr>\n",
+			i+1, markerLink(s.Hostel), s.Travel/1000, strings.Join(links, "<br>"))
 	}
 
-	return fmt.Sprintf("<table id=\"table\">\n<tr><th>%s</th><th>%s</th></tr>\n", headers...) + tableBody + "</table>"
+	return "<table>\n<tr><th>Night</th><th>Hostel</th><th>Travel</th><th>Waterfalls nearby</th></tr>\n" + tableBody + "</table>"
 }
 
-// assumes a map variable called map in the rest of the js
-func markerToJS(m Markers, color, linkPrefix string) string {
-	var js string
-	markerTemplate := "new mapboxgl.Marker({color: %q, scale: %f}).setLngLat([%f,%f]).setPopup(new mapboxgl.Popup({offset: 25}).setHTML(\""
-	if linkPrefix != "" {
-		markerTemplate = markerTemplate + "<a href='%s%s'>%s</a>"
-	} else {
-		markerTemplate = markerTemplate + "%s"
+// saveItineraryHTML writes a page showing the Itinerary as a table.
+func saveItineraryHTML(fname string, it Itinerary) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
 	}
-	markerTemplate = markerTemplate + "\")).addTo(map);\n"
+	defer f.Close()
 
-	for _, mark := range m.Markers {
-		if linkPrefix == "" {
-			js = js + fmt.Sprintf(markerTemplate, color, mark.scale, mark.Long, mark.Lat, mark.Name)
-			continue
+	var html string = `<!DOCTYPE html><html><head><meta charset="utf-8" /> <meta name="viewport" content="width=device-width, initial-scale=1.0, user-scalable=yes" />
+<title>Itinerary for holiday</title>
+<style>
+	body{
+		margin:1em auto;
+		max-width: 40em;
+		font: 1.2em/1.62 sans-serif;
+		padding: 0 0.62em;
+		color: #444;
+		background: #eeeeee;
+	}
+	table, th, td {
+		border: 1px solid black;
+		border-collapse: collapse;
+	}
+	th, td {
+		padding: 15px;
+	}
+	@media(prefers-color-scheme:dark) {
+		body{
+			background: #292929;
+			color: #fff;
 		}
-		// this bit making the link is a bit rough and some place names won't work
-		// but it's easier to manually fix broken links later in the html
-		var link string
-		if strings.Contains(linkPrefix, "yha") {
-			linkslice := strings.Split(mark.Name, " ")
-			if len(linkslice) > 3 {
-				linkslice = linkslice[:2]
-			}
-			link = strings.Join(linkslice, "-")
-			// remove commas and apostrophes
-			link = strings.ReplaceAll(link, ",", "")
-			link = strings.ReplaceAll(link, "'", "")
-		} else if strings.Contains(linkPrefix, "wiki") {
-			link = strings.ReplaceAll(mark.Name, " ", "_")
+		table, th, td {
+			color: #fff;
+		}
+		a {
+			color: #6cf;
+		}
+	}
+</style>
+</head>
+<body>
+<h1>Itinerary</h1>
+<p>
+` + fmt.Sprintf("Starting from %s, %d waterfalls in %d nights, travelling %.1f km between hostels.",
+		markerLink(it.Start), it.Waterfalls(), len(it.Stays), it.Travel()/1000) + `
+</p>
+` + itineraryToTable(it) + `
+</body>
+</html>
+`
+
+	_, err = f.Write([]byte(html))
+	return err
+}
+
+// tourToTable turns the Tour into a html table, with a row for each stop
+// and the distance to it from the last.
+func tourToTable(t Tour) string {
+	var tableBody string
+	for i, s := range t.Stops {
+		var d string
+		if i > 0 {
+			d = fmt.Sprintf("%.1f km", t.Legs[i-1]/1000)
 		}
-		js = js + fmt.Sprintf(markerTemplate, color, mark.scale, mark.Long, mark.Lat, linkPrefix, link, mark.Name)
+		tableBody += fmt.Sprintf("<tr><td>%d</td><td>%s</td><td>%s</td></tr>\n", i+1, markerLink(s), d)
+	}
+	tableBody += fmt.Sprintf("<tr><td></td><td>Total</td><td>%.1f km</td></tr>\n", t.Distance/1000)
+
+	return "<table>\n<tr><th>Stop</th><th>Name</th><th>Distance</th></tr>\n" + tableBody + "</table>"
+}
+
+// markerLink returns the name of m as html,
+// linking to m.URL if there is one.
+func markerLink(m Marker) string {
+	name := html.EscapeString(m.Name)
+	if m.URL == "" {
+		return name
+	}
+	return fmt.Sprintf("<a href=\"%s\">%s</a>", html.EscapeString(m.URL), name)
+}
+
+// The colours of each set of markers on the maps.
+const (
+	hostelColor    = "#550000"
+	waterfallColor = "#0044ff"
+	scotlandColor  = "#0055ff"
+	tourColor      = "#ff6600"
+)
+
+// markerToJS adds a mapbox marker for each of m, with a popup
+// showing its name and linking to its URL.
+// assumes a map variable called map in the rest of the js
+func markerToJS(m Markers, color string) string {
+	var js string
+	markerTemplate := "new mapboxgl.Marker({color: %q, scale: %f}).setLngLat([%f,%f]).setPopup(new mapboxgl.Popup({offset: 25}).setHTML(%q)).addTo(map);\n"
+
+	for _, mark := range m.Markers {
+		js = js + fmt.Sprintf(markerTemplate, color, mark.scale, mark.Long, mark.Lat, markerLink(mark))
 	}
 
 	return js
 }
 
+// routeToJS draws a line through the Markers in order, in color.
+// The line is added again whenever the map's style is changed,
+// which removes it.
+// assumes a map variable called map in the rest of the js
+func routeToJS(route []Marker, color string) string {
+	var coords []string
+	for _, mark := range route {
+		coords = append(coords, fmt.Sprintf("[%f,%f]", mark.Long, mark.Lat))
+	}
+	return `var route = {type: 'Feature', properties: {}, geometry: {type: 'LineString', coordinates: [` + strings.Join(coords, ",") + `]}};
+map.on('style.load', function() {
+	map.addSource('route', {type: 'geojson', data: route});
+	map.addLayer({id: 'route', type: 'line', source: 'route',
+		layout: {'line-join': 'round', 'line-cap': 'round'},
+		paint: {'line-color': ` + fmt.Sprintf("%q", color) + `, 'line-width': 3}});
+});
+`
+}
+
 func mapboxMapJS(mbox mapboxDetails, bbox string) string {
 	return `mapboxgl.accessToken = ` + fmt.Sprintf("%q", mbox.apikey) + `;
 var bbox = ` + bbox + `;
@@ -0,0 +1,336 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// reconcileDistance is how far apart in meters Markers with similar
+// names can be for reconcile to merge them.
+const reconcileDistance = 1000
+
+// minNameSimilarity is how similar, from 0 to 1, reconcile needs
+// the names of two nearby Markers to be to merge them.
+const minNameSimilarity = 0.8
+
+// minListSimilarity is how similar the names of two Markers from
+// different lists within duplicateDistance need to be for reconcile
+// to merge them, so that two places which happen to be close
+// together aren't taken for one.
+const minListSimilarity = 0.5
+
+// genericWords are left out of names when comparing them,
+// so "Falls of Rogie" is the same as "Rogie Falls".
+var genericWords = map[string]bool{
+	"the": true, "of": true, "a": true, "an": true, "and": true,
+	"falls": true, "fall": true, "waterfall": true, "waterfalls": true,
+	"force": true, "spout": true, "linn": true, "cascade": true, "cascades": true, "trail": true,
+	"hostel": true, "youth": true, "yha": true, "syha": true,
+}
+
+// nameWords returns the lower case words of name, without genericWords
+// unless there would be none left, sorted so their order doesn't matter.
+func nameWords(name string) []string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+	var specific []string
+	for _, w := range words {
+		if !genericWords[w] {
+			specific = append(specific, w)
+		}
+	}
+	if len(specific) > 0 {
+		words = specific
+	}
+	sort.Strings(words)
+	return words
+}
+
+// nameSimilarity returns how alike two names are, from 0 (nothing in
+// common) to 1 (the same words, ignoring case, order and genericWords).
+// It is the larger of the proportion of the words they share
+// and how few edits it takes to turn one into the other, which
+// allows for different spellings.
+func nameSimilarity(a, b string) float64 {
+	wa, wb := nameWords(a), nameWords(b)
+	set := make(map[string]bool)
+	for _, w := range wa {
+		set[w] = true
+	}
+	shared, union := 0, len(set)
+	for _, w := range wb {
+		if set[w] {
+			shared++
+			delete(set, w)
+		} else {
+			union++
+		}
+	}
+	jaccard := 0.0
+	if union > 0 {
+		jaccard = float64(shared) / float64(union)
+	}
+
+	ra, rb := []rune(strings.Join(wa, " ")), []rune(strings.Join(wb, " "))
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+	edit := 1 - float64(levenshtein(ra, rb))/float64(longest)
+	if edit > jaccard {
+		return edit
+	}
+	return jaccard
+}
+
+// levenshtein is the number of single rune insertions, deletions
+// and substitutions needed to turn a into b.
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// MergeDecision is reconcile's decision whether two Markers
+// are the same place.
+type MergeDecision struct {
+	A, B       Marker
+	Distance   float64
+	Similarity float64
+	Merged     bool
+	// Reason says why they were merged or kept apart.
+	Reason string
+}
+
+// reconcile merges the Markers in the sets which are the same place.
+// Two Markers are the same place if
+//   - they have the same URL, such as when Wikipedia redirects
+//     several names to one page, are within distance meters and their
+//     names have a nameSimilarity of at least minListSimilarity;
+//     URLs to part of a page (with a #fragment) don't count, as
+//     they are often to a list of many places,
+//   - their names have a nameSimilarity of at least minSimilarity
+//     and they are within distance meters, or
+//   - they are from different sets, within duplicateDistance and their
+//     names have a nameSimilarity of at least minListSimilarity,
+//     as lists seldom have two places so close together.
+//
+// and places which are the same as the same place are merged too.
+// Each group is merged into its first Marker, earlier sets first,
+// which keeps its position and is given the URL and Country of the
+// others if it has none. Its Attrs "aliases" and "sources" list the
+// other names and the Sources of all of them.
+// The merged Markers are returned in the set of their first Marker,
+// with a MergeDecision for each pair of Markers which were compared:
+// those within distance, or with the same URL however far apart.
+func reconcile(sets []Markers, distance, minSimilarity float64) ([]Markers, []MergeDecision) {
+	var all Markers
+	var setOf []int
+	for s, m := range sets {
+		all.Markers = append(all.Markers, m.Markers...)
+		for range m.Markers {
+			setOf = append(setOf, s)
+		}
+	}
+
+	parent := make([]int, len(all.Markers))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	var decisions []MergeDecision
+	decide := func(i, j int, d float64) {
+		a, b := all.Markers[i], all.Markers[j]
+		dec := MergeDecision{A: a, B: b, Distance: d, Similarity: nameSimilarity(a.Name, b.Name)}
+		switch {
+		case d > distance:
+			dec.Reason = "too far apart"
+		case samePage(a, b) && dec.Similarity >= minListSimilarity:
+			dec.Merged, dec.Reason = true, "same URL"
+		case dec.Similarity >= minSimilarity && d <= distance:
+			dec.Merged, dec.Reason = true, "similar names"
+		case setOf[i] != setOf[j] && d <= duplicateDistance && dec.Similarity >= minListSimilarity:
+			dec.Merged, dec.Reason = true, "same place in different lists"
+		default:
+			dec.Reason = "different names"
+		}
+		if dec.Merged {
+			// the earlier Marker is the root, so it is kept
+			ri, rj := find(i), find(j)
+			if ri > rj {
+				ri, rj = rj, ri
+			}
+			parent[rj] = ri
+		}
+		decisions = append(decisions, dec)
+	}
+
+	tree := newKDTree(all, geodesy.Haversine)
+	compared := make(map[[2]int]bool)
+	for i, mark := range all.Markers {
+		for _, n := range tree.withinIndexed(mark, distance) {
+			if n.i <= i {
+				continue
+			}
+			compared[[2]int{i, n.i}] = true
+			decide(i, n.i, n.Distance)
+		}
+	}
+	byURL := make(map[string][]int)
+	for i, mark := range all.Markers {
+		if samePage(mark, mark) {
+			byURL[mark.URL] = append(byURL[mark.URL], i)
+		}
+	}
+	for i, mark := range all.Markers {
+		for _, j := range byURL[mark.URL] {
+			if j > i && !compared[[2]int{i, j}] {
+				decide(i, j, distanceBn(geodesy.Haversine, mark, all.Markers[j]))
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range all.Markers {
+		r := find(i)
+		groups[r] = append(groups[r], i)
+	}
+	out := make([]Markers, len(sets))
+	for s, m := range sets {
+		out[s] = Markers{Source: m.Source, Fetched: m.Fetched}
+	}
+	for i := range all.Markers {
+		if find(i) != i {
+			continue
+		}
+		var members []Marker
+		for _, j := range groups[i] {
+			members = append(members, all.Markers[j])
+		}
+		out[setOf[i]].Markers = append(out[setOf[i]].Markers, mergeMarkers(members))
+	}
+	return out, decisions
+}
+
+// samePage reports whether a and b have the same URL,
+// which is to a whole page rather than part of one.
+func samePage(a, b Marker) bool {
+	return a.URL != "" && a.URL == b.URL && !strings.Contains(a.URL, "#")
+}
+
+// mergeMarkers merges the Markers into the first, as reconcile.
+func mergeMarkers(members []Marker) Marker {
+	kept := members[0]
+	if len(members) == 1 {
+		return kept
+	}
+	attrs := make(map[string]string, len(kept.Attrs)+2)
+	for k, v := range kept.Attrs {
+		attrs[k] = v
+	}
+	var aliases, sources []string
+	names := map[string]bool{strings.ToLower(kept.Name): true}
+	seenSource := make(map[string]bool)
+	for _, m := range members {
+		if !names[strings.ToLower(m.Name)] {
+			names[strings.ToLower(m.Name)] = true
+			aliases = append(aliases, m.Name)
+		}
+		if m.Source != "" && !seenSource[m.Source] {
+			seenSource[m.Source] = true
+			sources = append(sources, m.Source)
+		}
+		if kept.URL == "" {
+			kept.URL = m.URL
+		}
+		if kept.Country == "" {
+			kept.Country = m.Country
+		}
+		for k, v := range m.Attrs {
+			if _, ok := attrs[k]; !ok {
+				attrs[k] = v
+			}
+		}
+	}
+	if len(aliases) > 0 {
+		attrs["aliases"] = strings.Join(aliases, "; ")
+	}
+	if len(sources) > 0 {
+		attrs["sources"] = strings.Join(sources, "; ")
+	}
+	kept.Attrs = attrs
+	return kept
+}
+
+// mergeReport lists the MergeDecisions for review:
+// first those which merged Markers, then those which didn't.
+func mergeReport(decisions []MergeDecision) string {
+	var b strings.Builder
+	for _, merged := range []bool{true, false} {
+		if merged {
+			b.WriteString("Merged:\n")
+		} else {
+			b.WriteString("Kept apart:\n")
+		}
+		for _, d := range decisions {
+			if d.Merged != merged {
+				continue
+			}
+			fmt.Fprintf(&b, "\t%s / %s: %.0f m apart, names %.2f alike, %s\n",
+				withSource(d.A), withSource(d.B), d.Distance, d.Similarity, d.Reason)
+		}
+	}
+	return b.String()
+}
+
+// withSource returns the Marker's name, followed by its Source if it has one.
+func withSource(m Marker) string {
+	if m.Source == "" {
+		return m.Name
+	}
+	return fmt.Sprintf("%s (%s)", m.Name, m.Source)
+}
@@ -0,0 +1,126 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReconcile(t *testing.T) {
+	uk := Markers{Source: "uk", Markers: []Marker{
+		{Name: "Steall Waterfall", Lat: 56.7702, Long: -4.9791, Source: "uk"},
+		{Name: "Falls of Bruar", Lat: 56.7753, Long: -3.9381, Source: "uk"},
+		// different waterfalls which Wikipedia redirects to the same page
+		{Name: "Ingleton Falls", Lat: 54.1543, Long: -2.4713, Source: "uk", URL: "https://en.wikipedia.org/wiki/Ingleton_Waterfalls_Trail"},
+		{Name: "Pecca Falls", Lat: 54.1543, Long: -2.4713, Source: "uk", URL: "https://en.wikipedia.org/wiki/Ingleton_Waterfalls_Trail"},
+		// different waterfalls which share coordinates in the list
+		{Name: "Sgwd Gwladus", Lat: 51.75, Long: -3.59, Source: "uk"},
+		{Name: "Sgwd y Pannwr", Lat: 51.75, Long: -3.59, Source: "uk"},
+		{Name: "Falls of Foyers", Lat: 57.2510, Long: -4.4925, Source: "uk"},
+		{Name: "Reekie Linn", Lat: 56.6630, Long: -3.2210, Source: "uk"},
+		// the same page, and names alike enough with it
+		{Name: "Hardraw Force", Lat: 54.3239, Long: -2.2027, Source: "uk", URL: "https://en.wikipedia.org/wiki/Hardraw_Force"},
+		{Name: "Hardraw Scaur", Lat: 54.3260, Long: -2.2027, Source: "uk", URL: "https://en.wikipedia.org/wiki/Hardraw_Force"},
+		// the same page, but kilometres apart
+		{Name: "High Force", Lat: 54.6503, Long: -2.1856, Source: "uk", URL: "https://en.wikipedia.org/wiki/River_Tees"},
+		{Name: "Low Force", Lat: 54.6449, Long: -2.1500, Source: "uk", URL: "https://en.wikipedia.org/wiki/River_Tees"},
+		// citing the same footnote of a list
+		{Name: "Keld", Lat: 54.4058, Long: -2.1686, Source: "uk", URL: "https://en.wikipedia.org/wiki/List_of_youth_hostels#cite_ref-3"},
+		{Name: "Keld Lodge", Lat: 54.4050, Long: -2.1700, Source: "uk", URL: "https://en.wikipedia.org/wiki/List_of_youth_hostels#cite_ref-3"},
+	}}
+	scot := Markers{Source: "scot", Markers: []Marker{
+		// same name, slightly different location
+		{Name: "Steall waterfall", Lat: 56.7710, Long: -4.9800, Source: "scot", Attrs: map[string]string{"height": "120"}},
+		// different name, same place
+		{Name: "Bruar Falls", Lat: 56.7757, Long: -3.9385, Source: "scot"},
+		{Name: "Achness Falls", Lat: 57.9893, Long: -4.5924, Source: "scot"},
+		{Name: "Falls of Rogie", Lat: 57.5892, Long: -4.6040, Source: "scot"},
+		{Name: "Rogie Falls", Lat: 57.5892, Long: -4.6040, Source: "scot"},
+		// in both lists, but named differently
+		{Name: "Foyers Upper Falls", Lat: 57.2505, Long: -4.4920, Source: "scot"},
+		// a different waterfall close to one in the other list
+		{Name: "Slug of Auchrannie", Lat: 56.6617, Long: -3.2205, Source: "scot"},
+	}}
+
+	sets, decisions := reconcile([]Markers{uk, scot}, reconcileDistance, minNameSimilarity)
+	var names []string
+	for _, m := range sets[1].Markers {
+		names = append(names, m.Name)
+	}
+	if strings.Join(names, ",") != "Achness Falls,Falls of Rogie,Slug of Auchrannie" {
+		t.Errorf("scottish waterfalls left = %q; wanted Achness Falls, Falls of Rogie and Slug of Auchrannie", names)
+	}
+	if len(sets[0].Markers) != 13 || sets[0].Source != "uk" {
+		t.Fatalf("uk waterfalls = %+v", sets[0])
+	}
+	steall := sets[0].Markers[0]
+	if steall.Lat != 56.7702 || steall.Attrs["height"] != "120" || steall.Attrs["sources"] != "uk; scot" {
+		t.Errorf("merged Steall Waterfall = %+v", steall)
+	}
+	if _, ok := steall.Attrs["aliases"]; ok {
+		t.Errorf("Steall Waterfall has the same name as its alias: %+v", steall)
+	}
+	if bruar := sets[0].Markers[1]; bruar.Attrs["aliases"] != "Bruar Falls" {
+		t.Errorf("merged Falls of Bruar = %+v", bruar)
+	}
+	if ingleton := sets[0].Markers[2]; ingleton.Name != "Ingleton Falls" || len(ingleton.Attrs) != 0 {
+		t.Errorf("Ingleton Falls = %+v; wanted it not merged", ingleton)
+	}
+	if hardraw := sets[0].Markers[8]; hardraw.Name != "Hardraw Force" || hardraw.Attrs["aliases"] != "Hardraw Scaur" {
+		t.Errorf("merged Hardraw Force = %+v", hardraw)
+	}
+	if rogie := sets[1].Markers[1]; rogie.Attrs["aliases"] != "Rogie Falls" {
+		t.Errorf("merged Falls of Rogie = %+v", rogie)
+	}
+
+	reasons := make(map[string]string)
+	for _, d := range decisions {
+		reasons[d.A.Name+"/"+d.B.Name] = d.Reason
+	}
+	for pair, want := range map[string]string{
+		"Steall Waterfall/Steall waterfall":  "similar names",
+		"Falls of Bruar/Bruar Falls":         "similar names",
+		"Ingleton Falls/Pecca Falls":         "different names",
+		"Hardraw Force/Hardraw Scaur":        "same URL",
+		"High Force/Low Force":               "too far apart",
+		"Keld/Keld Lodge":                    "different names",
+		"Sgwd Gwladus/Sgwd y Pannwr":         "different names",
+		"Falls of Rogie/Rogie Falls":         "similar names",
+		"Falls of Foyers/Foyers Upper Falls": "same place in different lists",
+		"Reekie Linn/Slug of Auchrannie":     "different names",
+	} {
+		if reasons[pair] != want {
+			t.Errorf("decision for %s = %q; wanted %q", pair, reasons[pair], want)
+		}
+	}
+	report := mergeReport(decisions)
+	kept := strings.Index(report, "Kept apart:\n")
+	if kept < 0 || !strings.Contains(report[kept:], "\tSgwd Gwladus (uk) / Sgwd y Pannwr (uk): 0 m apart") {
+		t.Errorf("report is\n%s", report)
+	}
+}
+
+func TestNameSimilarity(t *testing.T) {
+	for _, tt := range []struct {
+		a, b    string
+		similar bool
+	}{
+		{"Spout of Garnock", "Garnock Spout", true},
+		{"Rogie Falls", "Falls of Rogie", true},
+		{"Sgwd Clun-gwyn", "Sgwd Clun-Gwyn", true},
+		{"Aysgarth Falls", "Aysgarth Force", true},
+		{"Pistyll Rhaeadr", "Pistyl Rhaeadr", true},
+		{"High Force", "Low Force", false},
+		{"Corra Linn", "Bonnington Linn", false},
+		{"Sgwd Isaf Clun-gwyn", "Sgwd Clun-gwyn", false},
+	} {
+		s := nameSimilarity(tt.a, tt.b)
+		if (s >= minNameSimilarity) != tt.similar {
+			t.Errorf("nameSimilarity(%q, %q) = %.2f", tt.a, tt.b, s)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// refreshMoveDistance is how far, in meters, a Marker must have moved
+// between the cache and a refresh to be reported. The cache keeps
+// six decimal places, so anything less is just rounding.
+const refreshMoveDistance = 10
+
+// Move is a Marker which is in a different place after a refresh.
+type Move struct {
+	Old, New Marker
+	// Distance is how far it moved in meters.
+	Distance float64
+}
+
+// Diff is what changed in a set of Markers between the cache and a refresh.
+type Diff struct {
+	Name      string
+	Added     []Marker
+	Removed   []Marker
+	Moved     []Move
+	Unchanged int
+}
+
+// refreshKey is what a Marker is known by when it has no URL.
+func refreshKey(m Marker) string {
+	return strings.ToLower(strings.TrimSpace(m.Name))
+}
+
+// pairMarkers finds the Marker in old which each of fresh is. pair[i]
+// is the index in old of fresh[i], or -1 if it is new; each Marker in
+// old is paired at most once. Markers are paired by name, preferring
+// one with the same URL. Otherwise a Marker renamed on its page is paired
+// by URL, but only if no other unpaired Marker has that URL: several
+// places can share a page, and then the name decides.
+func pairMarkers(old, fresh Markers) []int {
+	byURL := make(map[string][]int)
+	byName := make(map[string][]int)
+	for i, m := range old.Markers {
+		if m.URL != "" {
+			byURL[m.URL] = append(byURL[m.URL], i)
+		}
+		byName[refreshKey(m)] = append(byName[refreshKey(m)], i)
+	}
+	used := make([]bool, len(old.Markers))
+	first := func(is []int, ok func(i int) bool) int {
+		for _, i := range is {
+			if !used[i] && ok(i) {
+				used[i] = true
+				return i
+			}
+		}
+		return -1
+	}
+	always := func(int) bool { return true }
+
+	pair := make([]int, len(fresh.Markers))
+	for i, m := range fresh.Markers {
+		pair[i] = -1
+		if m.URL != "" {
+			pair[i] = first(byName[refreshKey(m)], func(j int) bool { return old.Markers[j].URL == m.URL })
+		}
+	}
+	for i, m := range fresh.Markers {
+		if pair[i] < 0 {
+			pair[i] = first(byName[refreshKey(m)], always)
+		}
+	}
+
+	// the URLs of the fresh Markers which are still unpaired
+	unpaired := make(map[string]int)
+	for i, m := range fresh.Markers {
+		if pair[i] < 0 && m.URL != "" {
+			unpaired[m.URL]++
+		}
+	}
+	for i, m := range fresh.Markers {
+		if pair[i] >= 0 || m.URL == "" || unpaired[m.URL] != 1 {
+			continue
+		}
+		var left []int
+		for _, j := range byURL[m.URL] {
+			if !used[j] {
+				left = append(left, j)
+			}
+		}
+		if len(left) == 1 {
+			pair[i] = first(left, always)
+		}
+	}
+	return pair
+}
+
+// diffMarkers compares a refreshed set of Markers with the cached ones.
+// Markers which moved less than moveDistance meters are unchanged.
+func diffMarkers(name string, old, fresh Markers, moveDistance float64) Diff {
+	d := Diff{Name: name}
+	pair := pairMarkers(old, fresh)
+	paired := make([]bool, len(old.Markers))
+	for i, m := range fresh.Markers {
+		if pair[i] < 0 {
+			d.Added = append(d.Added, m)
+			continue
+		}
+		o := old.Markers[pair[i]]
+		paired[pair[i]] = true
+		if dist := distanceBn(geodesy.Haversine, o, m); dist >= moveDistance {
+			d.Moved = append(d.Moved, Move{Old: o, New: m, Distance: dist})
+		} else {
+			d.Unchanged++
+		}
+	}
+	for i, m := range old.Markers {
+		if !paired[i] {
+			d.Removed = append(d.Removed, m)
+		}
+	}
+	sort.SliceStable(d.Moved, func(i, j int) bool { return d.Moved[i].Distance > d.Moved[j].Distance })
+	return d
+}
+
+// Changed reports whether anything was added, removed or moved.
+func (d Diff) Changed() bool {
+	return len(d.Added)+len(d.Removed)+len(d.Moved) > 0
+}
+
+// Text is a report of the changes, the furthest moves first.
+func (d Diff) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d added, %d removed, %d moved, %d unchanged\n",
+		d.Name, len(d.Added), len(d.Removed), len(d.Moved), d.Unchanged)
+	for _, m := range d.Added {
+		fmt.Fprintf(&b, "\t+ %s (%.5f, %.5f)\n", m.Name, m.Lat, m.Long)
+	}
+	for _, m := range d.Removed {
+		fmt.Fprintf(&b, "\t- %s (%.5f, %.5f)\n", m.Name, m.Lat, m.Long)
+	}
+	for _, mv := range d.Moved {
+		fmt.Fprintf(&b, "\t~ %s moved %s, from (%.5f, %.5f) to (%.5f, %.5f)\n",
+			mv.New.Name, formatMoved(mv.Distance), mv.Old.Lat, mv.Old.Long, mv.New.Lat, mv.New.Long)
+	}
+	return b.String()
+}
+
+// formatMoved formats a distance in meters, or in km from 1 km.
+func formatMoved(d float64) string {
+	if d < 1000 {
+		return fmt.Sprintf("%.0f m", d)
+	}
+	return fmt.Sprintf("%.1f km", d/1000)
+}
+
+// mergeRefresh returns the refreshed Markers to cache in place of old.
+// They are in the refreshed places, and those removed are left out,
+// but the URL, Country and Attrs which a refresh didn't get
+// are kept from the cache.
+func mergeRefresh(old, fresh Markers) Markers {
+	merged := fresh
+	merged.Markers = make([]Marker, len(fresh.Markers))
+	pair := pairMarkers(old, fresh)
+	for i, m := range fresh.Markers {
+		if pair[i] >= 0 {
+			o := old.Markers[pair[i]]
+			if m.URL == "" {
+				m.URL = o.URL
+			}
+			if m.Country == "" {
+				m.Country = o.Country
+			}
+			if len(o.Attrs) > 0 {
+				attrs := make(map[string]string)
+				for k, v := range o.Attrs {
+					attrs[k] = v
+				}
+				for k, v := range m.Attrs {
+					attrs[k] = v
+				}
+				m.Attrs = attrs
+			}
+		}
+		merged.Markers[i] = m
+	}
+	if merged.Source == "" {
+		merged.Source = old.Source
+	}
+	return merged
+}
@@ -0,0 +1,107 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffMarkers(t *testing.T) {
+	old := Markers{Source: "hostels.xml", Markers: []Marker{
+		{Name: "YHA Ambleside", Lat: 54.4205, Long: -2.9633, URL: "https://www.yha.org.uk/hostel/yha-ambleside", Attrs: map[string]string{"beds": "245"}},
+		{Name: "YHA Langdon Beck", Lat: 54.6807, Long: -2.2398, Country: "England"},
+		{Name: "YHA Grinton Lodge", Lat: 54.3801, Long: -1.9322},
+		{Name: "YHA Osmotherley", Lat: 54.3746, Long: -1.2991},
+		{Name: "YHA Haworth", Lat: 53.8300, Long: -1.9500},
+	}}
+	fresh := Markers{Source: "hostels.xml", Markers: []Marker{
+		// the same URL, but renamed
+		{Name: "Ambleside", Lat: 54.4205, Long: -2.9633, URL: "https://www.yha.org.uk/hostel/yha-ambleside", Attrs: map[string]string{"beds": "240"}},
+		// moved about 1.1 km north
+		{Name: "YHA Langdon Beck", Lat: 54.6907, Long: -2.2398},
+		// moved less than a meter
+		{Name: "yha grinton lodge", Lat: 54.380105, Long: -1.9322},
+		// moved about 22 m west
+		{Name: "YHA Osmotherley", Lat: 54.3746, Long: -1.2994},
+		{Name: "YHA Malham", Lat: 54.0611, Long: -2.1527},
+	}}
+
+	d := diffMarkers("hostels", old, fresh, refreshMoveDistance)
+	if len(d.Added) != 1 || d.Added[0].Name != "YHA Malham" {
+		t.Errorf("added %v; wanted YHA Malham", d.Added)
+	}
+	if len(d.Removed) != 1 || d.Removed[0].Name != "YHA Haworth" {
+		t.Errorf("removed %v; wanted YHA Haworth", d.Removed)
+	}
+	if len(d.Moved) != 2 || d.Moved[0].New.Name != "YHA Langdon Beck" || d.Moved[0].Distance < 1000 || d.Moved[0].Distance > 1200 ||
+		d.Moved[1].New.Name != "YHA Osmotherley" || d.Moved[1].Distance < 15 || d.Moved[1].Distance > 25 {
+		t.Errorf("moved %+v; wanted YHA Langdon Beck about 1.1 km and YHA Osmotherley about 20 m", d.Moved)
+	}
+	if d.Unchanged != 2 || !d.Changed() {
+		t.Errorf("%d unchanged; wanted 2", d.Unchanged)
+	}
+	report := d.Text()
+	for _, want := range []string{
+		"hostels: 1 added, 1 removed, 2 moved, 2 unchanged",
+		"+ YHA Malham", "- YHA Haworth", "~ YHA Langdon Beck moved 1.1 km", "~ YHA Osmotherley moved 19 m",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("report doesn't have %q:\n%s", want, report)
+		}
+	}
+	if diffMarkers("hostels", old, old, refreshMoveDistance).Changed() {
+		t.Error("the same Markers changed")
+	}
+
+	merged := mergeRefresh(old, fresh)
+	if len(merged.Markers) != len(fresh.Markers) || merged.Source != "hostels.xml" {
+		t.Fatalf("merged = %+v", merged)
+	}
+	if !reflect.DeepEqual(merged.Markers[0].Attrs, map[string]string{"beds": "240"}) {
+		t.Errorf("merged attrs = %v; wanted the refreshed ones", merged.Markers[0].Attrs)
+	}
+	if m := merged.Markers[1]; m.Lat != 54.6907 || m.Country != "England" {
+		t.Errorf("merged Langdon Beck = %+v; wanted the new place and the old country", m)
+	}
+	if fresh.Markers[1].Country != "" {
+		t.Error("mergeRefresh changed the refreshed Markers")
+	}
+}
+
+func TestPairMarkers(t *testing.T) {
+	const trail = "https://en.wikipedia.org/wiki/Ingleton_Waterfalls_Trail"
+	old := Markers{Markers: []Marker{
+		{Name: "Pecca Falls", Lat: 54.1627, Long: -2.4672, URL: trail},
+		{Name: "Thornton Force", Lat: 54.1695, Long: -2.4661, URL: trail},
+		{Name: "Beezley Falls", Lat: 54.1611, Long: -2.4447, URL: trail},
+		{Name: "Aira Force", Lat: 54.5753, Long: -2.9309, URL: "https://en.wikipedia.org/wiki/Aira_Force"},
+	}}
+	fresh := Markers{Markers: []Marker{
+		// they share a URL, so the names decide which is which
+		{Name: "Thornton Force", Lat: 54.1695, Long: -2.4661, URL: trail},
+		{Name: "Pecca Falls", Lat: 54.1627, Long: -2.4672, URL: trail},
+		// a new place on the same page isn't Beezley Falls renamed,
+		// as which of them was renamed can't be told
+		{Name: "Snow Falls", Lat: 54.1600, Long: -2.4450, URL: trail},
+		{Name: "Baxenghyll Gorge", Lat: 54.1620, Long: -2.4460, URL: trail},
+		// but a Marker with a page of its own can be renamed
+		{Name: "Aira Force waterfall", Lat: 54.5753, Long: -2.9309, URL: "https://en.wikipedia.org/wiki/Aira_Force"},
+	}}
+	if got, want := pairMarkers(old, fresh), []int{1, 0, -1, -1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pairMarkers = %v; wanted %v", got, want)
+	}
+	if d := diffMarkers("waterfalls", old, fresh, refreshMoveDistance); len(d.Moved) != 0 || d.Unchanged != 3 {
+		t.Errorf("moved %+v and %d unchanged; wanted none moved and 3 unchanged", d.Moved, d.Unchanged)
+	}
+
+	// with one left on the page, it was renamed
+	fresh.Markers = fresh.Markers[:3]
+	if got, want := pairMarkers(old, fresh), []int{1, 0, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pairMarkers with one new place on the page = %v; wanted %v", got, want)
+	}
+}
@@ -0,0 +1,259 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// Region is an area of the Earth which Markers may be in.
+type Region interface {
+	Contains(m Marker) bool
+}
+
+// BBox is the Region between two lines of latitude and two of longitude.
+// If MinLong is greater than MaxLong, the box crosses the antimeridian.
+type BBox struct {
+	MinLong, MinLat, MaxLong, MaxLat float64
+}
+
+// ukBounds is a BBox around the UK, from the Scilly Isles and
+// St Kilda to Shetland and Lowestoft.
+var ukBounds = BBox{MinLong: -8.7, MinLat: 49.8, MaxLong: 1.8, MaxLat: 61}
+
+// Contains reports whether m is in the box, including on its edge.
+func (b BBox) Contains(m Marker) bool {
+	if m.Lat < b.MinLat || m.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLong <= b.MaxLong {
+		return m.Long >= b.MinLong && m.Long <= b.MaxLong
+	}
+	return m.Long >= b.MinLong || m.Long <= b.MaxLong
+}
+
+// Circle is the Region within Radius meters of Centre, on the sphere.
+type Circle struct {
+	Centre Marker
+	Radius float64
+}
+
+// Contains reports whether m is within the Circle.
+func (c Circle) Contains(m Marker) bool {
+	return distanceBn(geodesy.Haversine, c.Centre, m) <= c.Radius
+}
+
+// ring is a closed line of [long, lat] positions, as in GeoJSON.
+type ring [][]float64
+
+// contains reports whether m is inside r, by counting how many
+// of its edges a line due east from m crosses. Latitude and longitude
+// are treated as flat, which is close enough for areas the size of
+// a national park.
+func (r ring) contains(m Marker) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a[1] > m.Lat) != (b[1] > m.Lat) {
+			long := a[0] + (m.Lat-a[1])*(b[0]-a[0])/(b[1]-a[1])
+			if m.Long < long {
+				in = !in
+			}
+		}
+	}
+	return in
+}
+
+// Polygon is a GeoJSON Polygon: an outer ring, then any holes in it.
+type Polygon []ring
+
+// Contains reports whether m is inside the outer ring
+// and not in any of the holes.
+func (p Polygon) Contains(m Marker) bool {
+	if len(p) == 0 || !p[0].contains(m) {
+		return false
+	}
+	for _, hole := range p[1:] {
+		if hole.contains(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// check checks every position of p has a longitude and latitude.
+func (p Polygon) check() error {
+	for _, r := range p {
+		for _, pos := range r {
+			if len(pos) < 2 {
+				return fmt.Errorf("position %v has fewer than 2 coordinates", pos)
+			}
+		}
+	}
+	return nil
+}
+
+// AnyOf is the Region made of every one of its Regions.
+type AnyOf []Region
+
+// Contains reports whether m is in any of the Regions.
+func (rs AnyOf) Contains(m Marker) bool {
+	for _, r := range rs {
+		if r.Contains(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// AllOf is the Region where all of its Regions overlap.
+type AllOf []Region
+
+// Contains reports whether m is in every one of the Regions.
+func (rs AllOf) Contains(m Marker) bool {
+	for _, r := range rs {
+		if !r.Contains(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// within returns the Markers in m which are in r.
+func (m Markers) within(r Region) Markers {
+	in := Markers{Source: m.Source, Fetched: m.Fetched}
+	for _, mark := range m.Markers {
+		if r.Contains(mark) {
+			in.Markers = append(in.Markers, mark)
+		}
+	}
+	return in
+}
+
+// parseFloats parses n comma separated numbers.
+func parseFloats(s string, n int) ([]float64, error) {
+	fields := strings.Split(s, ",")
+	if len(fields) != n {
+		return nil, fmt.Errorf("%q: want %d comma separated numbers", s, n)
+	}
+	fs := make([]float64, n)
+	for i, f := range fields {
+		var err error
+		if fs[i], err = strconv.ParseFloat(strings.TrimSpace(f), 64); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// ParseBBox parses "minLong,minLat,maxLong,maxLat", the order of a GeoJSON
+// bbox and of formatBounds, or "uk" for ukBounds.
+func ParseBBox(s string) (BBox, error) {
+	if strings.EqualFold(s, "uk") {
+		return ukBounds, nil
+	}
+	fs, err := parseFloats(s, 4)
+	if err != nil {
+		return BBox{}, err
+	}
+	b := BBox{MinLong: fs[0], MinLat: fs[1], MaxLong: fs[2], MaxLat: fs[3]}
+	if b.MinLat > b.MaxLat {
+		return b, fmt.Errorf("%q: minimum latitude is above the maximum", s)
+	}
+	return b, nil
+}
+
+// ParseCircle parses "lat,long,km".
+func ParseCircle(s string) (Circle, error) {
+	fs, err := parseFloats(s, 3)
+	if err != nil {
+		return Circle{}, err
+	}
+	return Circle{Centre: Marker{Lat: fs[0], Long: fs[1]}, Radius: fs[2] * 1000}, nil
+}
+
+// ReadRegion reads the Polygons and MultiPolygons in the GeoJSON in r,
+// which may be a FeatureCollection, Feature or bare geometry.
+// The Region is all of them together; other geometries are ignored.
+func ReadRegion(r io.Reader) (Region, error) {
+	var g geoJSON
+	if err := json.NewDecoder(r).Decode(&g); err != nil {
+		return nil, err
+	}
+	var region AnyOf
+	if err := g.polygons(&region); err != nil {
+		return nil, err
+	}
+	if len(region) == 0 {
+		return nil, errors.New("no polygons")
+	}
+	return region, nil
+}
+
+// polygons appends each Polygon in g to region.
+func (g *geoJSON) polygons(region *AnyOf) error {
+	switch g.Type {
+	case "FeatureCollection":
+		for i := range g.Features {
+			if err := g.Features[i].polygons(region); err != nil {
+				return fmt.Errorf("feature %d: %v", i, err)
+			}
+		}
+	case "Feature":
+		if g.Geometry != nil {
+			return g.Geometry.polygons(region)
+		}
+	case "GeometryCollection":
+		for i := range g.Geometries {
+			if err := g.Geometries[i].polygons(region); err != nil {
+				return err
+			}
+		}
+	case "Polygon":
+		var p Polygon
+		if err := json.Unmarshal(g.Coordinates, &p); err != nil {
+			return err
+		}
+		if err := p.check(); err != nil {
+			return err
+		}
+		*region = append(*region, p)
+	case "MultiPolygon":
+		var ps []Polygon
+		if err := json.Unmarshal(g.Coordinates, &ps); err != nil {
+			return err
+		}
+		for _, p := range ps {
+			if err := p.check(); err != nil {
+				return err
+			}
+			*region = append(*region, p)
+		}
+	}
+	return nil
+}
+
+// RegionFromGeoJSON reads a Region from a GeoJSON file using ReadRegion.
+func RegionFromGeoJSON(filename string) (Region, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := ReadRegion(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,101 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegions(t *testing.T) {
+	highForce := Marker{Name: "High Force", Lat: 54.6503, Long: -2.1856}
+	aira := Marker{Name: "Aira Force", Lat: 54.5733, Long: -2.9297}
+	abbotsford := Marker{Name: "Abbotsford", Lat: 49.0504, Long: -122.3045}
+	// a square round Teesdale with a hole round High Force
+	teesdale := Polygon{
+		ring{{-2.5, 54.5}, {-2.0, 54.5}, {-2.0, 54.8}, {-2.5, 54.8}, {-2.5, 54.5}},
+		ring{{-2.2, 54.6}, {-2.17, 54.6}, {-2.17, 54.7}, {-2.2, 54.7}, {-2.2, 54.6}},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		r      Region
+		mark   Marker
+		inside bool
+	}{
+		{"uk", ukBounds, highForce, true},
+		{"uk", ukBounds, abbotsford, false},
+		{"antimeridian", BBox{MinLong: 170, MinLat: -50, MaxLong: -170, MaxLat: -30}, Marker{Lat: -40, Long: 179}, true},
+		{"antimeridian", BBox{MinLong: 170, MinLat: -50, MaxLong: -170, MaxLat: -30}, Marker{Lat: -40, Long: 0}, false},
+		{"circle", Circle{Centre: highForce, Radius: 40000}, aira, false},
+		{"circle", Circle{Centre: highForce, Radius: 60000}, aira, true},
+		{"polygon", teesdale, Marker{Lat: 54.7, Long: -2.3}, true},
+		{"polygon hole", teesdale, highForce, false},
+		{"polygon", teesdale, aira, false},
+		{"any", AnyOf{teesdale, Circle{Centre: aira, Radius: 1}}, aira, true},
+		{"all", AllOf{ukBounds, teesdale}, aira, false},
+	} {
+		if got := tt.r.Contains(tt.mark); got != tt.inside {
+			t.Errorf("%s: Contains(%s) = %v; wanted %v", tt.name, tt.mark.Name, got, tt.inside)
+		}
+	}
+
+	m := Markers{Source: "test", Markers: []Marker{highForce, aira, abbotsford}}
+	in := m.within(ukBounds)
+	if len(in.Markers) != 2 || in.Source != "test" {
+		t.Errorf("within(ukBounds) = %+v", in)
+	}
+}
+
+func TestParseRegions(t *testing.T) {
+	b, err := ParseBBox("-3.5, 54, -2, 55")
+	if err != nil || b != (BBox{MinLong: -3.5, MinLat: 54, MaxLong: -2, MaxLat: 55}) {
+		t.Errorf("ParseBBox = %+v, %v", b, err)
+	}
+	if _, err := ParseBBox("-3.5,55,-2,54"); err == nil {
+		t.Error("parsed an upside down bbox")
+	}
+	if b, _ := ParseBBox("UK"); b != ukBounds {
+		t.Errorf("ParseBBox(UK) = %+v", b)
+	}
+	c, err := ParseCircle("54.6,-2.2,20")
+	if err != nil || c.Centre.Lat != 54.6 || c.Centre.Long != -2.2 || c.Radius != 20000 {
+		t.Errorf("ParseCircle = %+v, %v", c, err)
+	}
+	if _, err := ParseCircle("54.6,-2.2"); err == nil {
+		t.Error("parsed a circle without a radius")
+	}
+}
+
+func TestReadRegion(t *testing.T) {
+	r, err := ReadRegion(strings.NewReader(`{"type": "FeatureCollection", "features": [
+		{"type": "Feature", "properties": {"name": "Lake District"}, "geometry": {"type": "MultiPolygon", "coordinates": [
+			[[[-3.5, 54.1], [-2.7, 54.1], [-2.7, 54.8], [-3.5, 54.8], [-3.5, 54.1]]]
+		]}},
+		{"type": "Feature", "geometry": {"type": "Point", "coordinates": [0, 0]}},
+		{"type": "Feature", "geometry": {"type": "Polygon", "coordinates": [
+			[[-2.5, 54.5], [-2.0, 54.5], [-2.0, 54.8], [-2.5, 54.8], [-2.5, 54.5]]
+		]}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range []Marker{{Lat: 54.5733, Long: -2.9297}, {Lat: 54.6503, Long: -2.1856}} {
+		if !r.Contains(m) {
+			t.Errorf("region doesn't contain %+v", m)
+		}
+	}
+	if r.Contains(Marker{Lat: 54.6, Long: -2.6}) {
+		t.Error("region contains a point between its polygons")
+	}
+
+	if _, err := ReadRegion(strings.NewReader(`{"type": "Point", "coordinates": [0, 0]}`)); err == nil {
+		t.Error("read a region without polygons")
+	}
+	if _, err := ReadRegion(strings.NewReader(`{"type": "Polygon", "coordinates": [[[0], [1, 1], [0, 1]]]}`)); err == nil {
+		t.Error("read a polygon with a bad position")
+	}
+}
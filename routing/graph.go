@@ -0,0 +1,337 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+// Package routing finds walking routes over the paths and roads
+// in an OpenStreetMap extract.
+package routing
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// Naismith's rule: walking takes an hour for every 5 km,
+// plus an hour for every 600 m of ascent.
+const (
+	walkingSpeed = 5000.0 / 3600 // meters per second
+	climbRate    = 600.0 / 3600  // meters of ascent per second
+)
+
+// maxSnap is the furthest, in meters, a point can be from
+// the nearest node of a Graph to be routed from or to.
+const maxSnap = 2000
+
+// cellSize is the size in degrees of the cells of a Graph's grid.
+// A degree of latitude is a little over 111 km, so a cell is
+// at least maxSnap high.
+const cellSize = maxSnap / 111000.0
+
+// walkable are the values of the highway tag of ways which can be walked along.
+var walkable = map[string]bool{
+	"footway": true, "path": true, "track": true, "bridleway": true,
+	"steps": true, "pedestrian": true, "cycleway": true, "living_street": true,
+	"residential": true, "unclassified": true, "service": true, "road": true,
+	"tertiary": true, "tertiary_link": true, "secondary": true, "secondary_link": true,
+	"primary": true, "primary_link": true, "trunk": true, "trunk_link": true,
+}
+
+// Walkable reports whether a way with the tags can be walked along.
+func Walkable(tags map[string]string) bool {
+	if !walkable[tags["highway"]] {
+		return false
+	}
+	switch tags["foot"] {
+	case "no", "private", "use_sidepath":
+		return false
+	case "yes", "designated", "permissive":
+		return true
+	}
+	switch tags["access"] {
+	case "no", "private":
+		return false
+	}
+	return true
+}
+
+// Graph is a network of walkable ways.
+type Graph struct {
+	lat, long []float64
+	// ele is the elevation in meters of each node, or NaN if unknown
+	ele   []float64
+	edges [][]edge
+	// grid is the nodes with edges in each cell, for finding the nearest
+	grid map[cell][]int
+}
+
+// cell is the position of a cellSize square in a Graph's grid.
+type cell struct{ lat, long int }
+
+func cellOf(lat, long float64) cell {
+	return cell{int(math.Floor(lat / cellSize)), int(math.Floor(long / cellSize))}
+}
+
+type edge struct {
+	to     int
+	length float64 // meters
+	ascent float64 // meters climbed going along the edge
+}
+
+// Route is a walk between two points.
+type Route struct {
+	// Distance is the length in meters of the walk,
+	// including getting to and from the nearest paths.
+	Distance float64
+	// Ascent is how far in meters the walk climbs, where it is known.
+	Ascent float64
+}
+
+// Time is how long the Route takes to walk according to Naismith's rule.
+func (r Route) Time() time.Duration {
+	secs := r.Distance/walkingSpeed + r.Ascent/climbRate
+	return time.Duration(secs * float64(time.Second))
+}
+
+// Load builds a Graph of the walkable ways in an OSM PBF file.
+// The file is read twice: first for the ways, then for only the
+// nodes on them, so that big extracts need less memory.
+func Load(filename string) (*Graph, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var ways []Way
+	index := make(map[int64]int)
+	err = scanPBF(f, nil, func(w Way) {
+		if !Walkable(w.Tags) {
+			return
+		}
+		ways = append(ways, Way{ID: w.ID, Refs: w.Refs})
+		for _, r := range w.Refs {
+			index[r] = -1
+		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	g := &Graph{}
+	err = scanPBF(f, func(n Node) {
+		if i, ok := index[n.ID]; !ok || i != -1 {
+			return
+		}
+		index[n.ID] = len(g.lat)
+		g.addNode(n)
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	g.edges = make([][]edge, len(g.lat))
+	for _, w := range ways {
+		g.addWay(w, index)
+	}
+	g.buildGrid()
+	return g, nil
+}
+
+// New builds a Graph from the nodes and the walkable ones of the ways.
+func New(nodes []Node, ways []Way) *Graph {
+	g := &Graph{}
+	index := make(map[int64]int)
+	for _, n := range nodes {
+		index[n.ID] = len(g.lat)
+		g.addNode(n)
+	}
+	g.edges = make([][]edge, len(g.lat))
+	for _, w := range ways {
+		if Walkable(w.Tags) {
+			g.addWay(w, index)
+		}
+	}
+	g.buildGrid()
+	return g
+}
+
+func (g *Graph) addNode(n Node) {
+	g.lat = append(g.lat, n.Lat)
+	g.long = append(g.long, n.Long)
+	ele := math.NaN()
+	if e, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(n.Tags["ele"]), " m"), 64); err == nil {
+		ele = e
+	}
+	g.ele = append(g.ele, ele)
+}
+
+// addWay adds edges both ways between each pair of nodes along w.
+// Nodes missing from the extract are skipped.
+// The change in height between nodes with known elevations is put on
+// the edges next to the second of them, as ascent in the direction
+// which climbs.
+func (g *Graph) addWay(w Way, index map[int64]int) {
+	prev := -1
+	lastEle := math.NaN()
+	for _, ref := range w.Refs {
+		i, ok := index[ref]
+		if !ok || i < 0 {
+			prev = -1
+			lastEle = math.NaN()
+			continue
+		}
+		var up, down float64
+		if !math.IsNaN(g.ele[i]) {
+			if rise := g.ele[i] - lastEle; rise > 0 {
+				up = rise
+			} else if rise < 0 {
+				down = -rise
+			}
+			lastEle = g.ele[i]
+		}
+		if prev >= 0 && prev != i {
+			length := geodesy.Haversine(g.point(prev), g.point(i))
+			g.edges[prev] = append(g.edges[prev], edge{to: i, length: length, ascent: up})
+			g.edges[i] = append(g.edges[i], edge{to: prev, length: length, ascent: down})
+		}
+		prev = i
+	}
+}
+
+func (g *Graph) point(i int) geodesy.Point {
+	return geodesy.Point{Lat: g.lat[i], Long: g.long[i]}
+}
+
+// Len is the number of nodes in g.
+func (g *Graph) Len() int {
+	return len(g.lat)
+}
+
+// buildGrid puts each node with edges in its cell of g.grid.
+func (g *Graph) buildGrid() {
+	g.grid = make(map[cell][]int)
+	for i := range g.lat {
+		if len(g.edges[i]) > 0 {
+			c := cellOf(g.lat[i], g.long[i])
+			g.grid[c] = append(g.grid[c], i)
+		}
+	}
+}
+
+// nearest returns the node with edges nearest to p, and its distance,
+// or -1 if there isn't one within maxSnap.
+// Only the cells of g.grid which can be within maxSnap are looked in:
+// the one p is in and those next to it, and further east and west
+// where the cells are narrower than maxSnap away from the equator.
+func (g *Graph) nearest(p geodesy.Point) (int, float64) {
+	best, bestD := -1, float64(maxSnap)
+	c := cellOf(p.Lat, p.Long)
+	lat := math.Min(math.Abs(p.Lat)+cellSize, 89)
+	// one more for the great circle being shorter than the parallel
+	wide := int(math.Ceil(1/math.Cos(lat*math.Pi/180))) + 1
+	for y := c.lat - 1; y <= c.lat+1; y++ {
+		for x := c.long - wide; x <= c.long+wide; x++ {
+			for _, i := range g.grid[cell{y, x}] {
+				d := geodesy.Haversine(p, g.point(i))
+				// of nodes as near, the first is used, whatever cell it is in
+				if d < bestD || (d == bestD && best >= 0 && i < best) {
+					best, bestD = i, d
+				}
+			}
+		}
+	}
+	return best, bestD
+}
+
+// Routes finds the shortest walks from from to each of to,
+// not searching further than maxDistance meters.
+// ok[i] is false if there is no walk to to[i] within maxDistance,
+// or if from or to[i] is more than 2 km from a path.
+func (g *Graph) Routes(from geodesy.Point, to []geodesy.Point, maxDistance float64) (routes []Route, ok []bool) {
+	routes = make([]Route, len(to))
+	ok = make([]bool, len(to))
+	start, startD := g.nearest(from)
+	if start < 0 {
+		return routes, ok
+	}
+
+	// the nodes to find, and which of to they are for
+	targets := make(map[int][]int)
+	var snap []float64
+	for i, p := range to {
+		n, d := g.nearest(p)
+		snap = append(snap, d)
+		if n >= 0 {
+			targets[n] = append(targets[n], i)
+		}
+	}
+
+	dist := make(map[int]float64)
+	ascent := make(map[int]float64)
+	done := make(map[int]bool)
+	q := &pqueue{{node: start, dist: startD}}
+	dist[start] = startD
+	for q.Len() > 0 && len(targets) > 0 {
+		item := heap.Pop(q).(pqItem)
+		n := item.node
+		if done[n] {
+			continue
+		}
+		done[n] = true
+		if item.dist > maxDistance {
+			break
+		}
+		for _, i := range targets[n] {
+			routes[i] = Route{Distance: item.dist + snap[i], Ascent: ascent[n]}
+			ok[i] = routes[i].Distance <= maxDistance
+		}
+		delete(targets, n)
+
+		for _, e := range g.edges[n] {
+			d := item.dist + e.length
+			if old, seen := dist[e.to]; !seen || d < old {
+				dist[e.to] = d
+				ascent[e.to] = ascent[n] + e.ascent
+				heap.Push(q, pqItem{node: e.to, dist: d})
+			}
+		}
+	}
+	return routes, ok
+}
+
+// Route finds the shortest walk from a to b, as Routes.
+func (g *Graph) Route(a, b geodesy.Point, maxDistance float64) (Route, bool) {
+	r, ok := g.Routes(a, []geodesy.Point{b}, maxDistance)
+	return r[0], ok[0]
+}
+
+type pqItem struct {
+	node int
+	dist float64
+}
+
+// pqueue is a min-heap of nodes by distance, for Dijkstra's algorithm.
+type pqueue []pqItem
+
+func (q pqueue) Len() int            { return len(q) }
+func (q pqueue) Less(i, j int) bool  { return q[i].dist < q[j].dist }
+func (q pqueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *pqueue) Push(x interface{}) { *q = append(*q, x.(pqItem)) }
+func (q *pqueue) Pop() interface{} {
+	old := *q
+	x := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,441 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package routing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// The OSM PBF format is a series of blobs, each with a header,
+// holding protocol buffers. See https://wiki.openstreetmap.org/wiki/PBF_Format.
+// Only the parts needed to read nodes and ways are decoded here.
+
+// maxBlobSize is the largest blob the format allows.
+const maxBlobSize = 32 << 20
+
+// Node is an OSM node.
+type Node struct {
+	ID        int64
+	Lat, Long float64
+	Tags      map[string]string
+}
+
+// Way is an OSM way, a line through the nodes with the IDs in Refs.
+type Way struct {
+	ID   int64
+	Refs []int64
+	Tags map[string]string
+}
+
+// scanPBF reads the OSM PBF data in r, calling node for each node
+// and way for each way. Either may be nil to skip decoding them.
+func scanPBF(r io.Reader, node func(Node), way func(Way)) error {
+	var sizeBuf [4]byte
+	for {
+		if _, err := io.ReadFull(r, sizeBuf[:]); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		size := binary.BigEndian.Uint32(sizeBuf[:])
+		if size > 64<<10 {
+			return fmt.Errorf("blob header of %d bytes is too big", size)
+		}
+		hb := make([]byte, size)
+		if _, err := io.ReadFull(r, hb); err != nil {
+			return err
+		}
+		var typ string
+		var dataSize int64
+		err := eachField(hb, func(f field) error {
+			switch f.num {
+			case 1:
+				typ = string(f.bytes)
+			case 3:
+				dataSize = int64(f.varint)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if dataSize > maxBlobSize {
+			return fmt.Errorf("blob of %d bytes is too big", dataSize)
+		}
+		blob := make([]byte, dataSize)
+		if _, err := io.ReadFull(r, blob); err != nil {
+			return err
+		}
+
+		switch typ {
+		case "OSMHeader":
+			data, err := blobData(blob)
+			if err != nil {
+				return err
+			}
+			if err := checkHeader(data); err != nil {
+				return err
+			}
+		case "OSMData":
+			if node == nil && way == nil {
+				continue
+			}
+			data, err := blobData(blob)
+			if err != nil {
+				return err
+			}
+			if err := decodeBlock(data, node, way); err != nil {
+				return err
+			}
+		}
+		// other types of blob can be ignored
+	}
+}
+
+// blobData returns the uncompressed contents of a Blob.
+func blobData(blob []byte) ([]byte, error) {
+	var data []byte
+	var compressed bool
+	err := eachField(blob, func(f field) error {
+		switch f.num {
+		case 1: // raw
+			data = f.bytes
+		case 3: // zlib_data
+			data, compressed = f.bytes, true
+		case 4, 5, 6, 7:
+			return errors.New("only raw and zlib compressed blobs are supported")
+		}
+		return nil
+	})
+	if err != nil || !compressed {
+		return data, err
+	}
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(io.LimitReader(zr, maxBlobSize))
+}
+
+// checkHeader checks that we can read everything a HeaderBlock
+// says is needed to read the file.
+func checkHeader(data []byte) error {
+	return eachField(data, func(f field) error {
+		if f.num == 4 { // required_features
+			switch s := string(f.bytes); s {
+			case "OsmSchema-V0.6", "DenseNodes":
+			default:
+				return fmt.Errorf("unsupported required feature %q", s)
+			}
+		}
+		return nil
+	})
+}
+
+// decodeBlock decodes a PrimitiveBlock.
+func decodeBlock(data []byte, node func(Node), way func(Way)) error {
+	var strings [][]byte
+	var groups [][]byte
+	granularity := int64(100)
+	var latOffset, longOffset int64
+	err := eachField(data, func(f field) error {
+		switch f.num {
+		case 1:
+			return eachField(f.bytes, func(s field) error {
+				if s.num == 1 {
+					strings = append(strings, s.bytes)
+				}
+				return nil
+			})
+		case 2:
+			groups = append(groups, f.bytes)
+		case 17:
+			granularity = int64(f.varint)
+		case 19:
+			latOffset = int64(f.varint)
+		case 20:
+			longOffset = int64(f.varint)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	b := block{strings: strings, granularity: granularity, latOffset: latOffset, longOffset: longOffset}
+	for _, g := range groups {
+		err := eachField(g, func(f field) error {
+			switch f.num {
+			case 1:
+				if node != nil {
+					n, err := b.node(f.bytes)
+					if err != nil {
+						return err
+					}
+					node(n)
+				}
+			case 2:
+				if node != nil {
+					return b.denseNodes(f.bytes, node)
+				}
+			case 3:
+				if way != nil {
+					w, err := b.way(f.bytes)
+					if err != nil {
+						return err
+					}
+					way(w)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// block is the information in a PrimitiveBlock shared by its elements.
+type block struct {
+	strings               [][]byte
+	granularity           int64
+	latOffset, longOffset int64
+}
+
+func (b *block) lat(l int64) float64  { return 1e-9 * float64(b.latOffset+b.granularity*l) }
+func (b *block) long(l int64) float64 { return 1e-9 * float64(b.longOffset+b.granularity*l) }
+
+func (b *block) str(i uint64) (string, error) {
+	if i >= uint64(len(b.strings)) {
+		return "", fmt.Errorf("string %d out of range", i)
+	}
+	return string(b.strings[i]), nil
+}
+
+// tags makes the tags from the string table indices in keys and vals.
+func (b *block) tags(keys, vals []uint64) (map[string]string, error) {
+	if len(keys) != len(vals) {
+		return nil, errors.New("different numbers of tag keys and values")
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	tags := make(map[string]string, len(keys))
+	for i := range keys {
+		k, err := b.str(keys[i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := b.str(vals[i])
+		if err != nil {
+			return nil, err
+		}
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (b *block) node(data []byte) (Node, error) {
+	var n Node
+	var keys, vals []uint64
+	var lat, long int64
+	err := eachField(data, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			n.ID = unzigzag(f.varint)
+		case 2:
+			keys, err = f.varints(keys)
+		case 3:
+			vals, err = f.varints(vals)
+		case 8:
+			lat = unzigzag(f.varint)
+		case 9:
+			long = unzigzag(f.varint)
+		}
+		return err
+	})
+	if err != nil {
+		return n, err
+	}
+	n.Lat, n.Long = b.lat(lat), b.long(long)
+	n.Tags, err = b.tags(keys, vals)
+	return n, err
+}
+
+func (b *block) denseNodes(data []byte, node func(Node)) error {
+	var ids, lats, longs, kvs []uint64
+	err := eachField(data, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			ids, err = f.varints(ids)
+		case 8:
+			lats, err = f.varints(lats)
+		case 9:
+			longs, err = f.varints(longs)
+		case 10:
+			kvs, err = f.varints(kvs)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if len(lats) != len(ids) || len(longs) != len(ids) {
+		return errors.New("dense nodes have different numbers of ids and coordinates")
+	}
+
+	// ids and coordinates are delta coded; keys_vals are pairs ending in 0 for each node
+	var id, lat, long int64
+	for i := range ids {
+		id += unzigzag(ids[i])
+		lat += unzigzag(lats[i])
+		long += unzigzag(longs[i])
+		n := Node{ID: id, Lat: b.lat(lat), Long: b.long(long)}
+		for len(kvs) > 0 {
+			k := kvs[0]
+			kvs = kvs[1:]
+			if k == 0 {
+				break
+			}
+			if len(kvs) == 0 {
+				return errors.New("dense node key without a value")
+			}
+			key, err := b.str(k)
+			if err != nil {
+				return err
+			}
+			val, err := b.str(kvs[0])
+			if err != nil {
+				return err
+			}
+			kvs = kvs[1:]
+			if n.Tags == nil {
+				n.Tags = make(map[string]string)
+			}
+			n.Tags[key] = val
+		}
+		node(n)
+	}
+	return nil
+}
+
+func (b *block) way(data []byte) (Way, error) {
+	var w Way
+	var keys, vals, refs []uint64
+	err := eachField(data, func(f field) error {
+		var err error
+		switch f.num {
+		case 1:
+			w.ID = int64(f.varint)
+		case 2:
+			keys, err = f.varints(keys)
+		case 3:
+			vals, err = f.varints(vals)
+		case 8:
+			refs, err = f.varints(refs)
+		}
+		return err
+	})
+	if err != nil {
+		return w, err
+	}
+	var ref int64
+	w.Refs = make([]int64, len(refs))
+	for i, r := range refs {
+		ref += unzigzag(r)
+		w.Refs[i] = ref
+	}
+	w.Tags, err = b.tags(keys, vals)
+	return w, err
+}
+
+// field is a protocol buffer field. Varints are in varint,
+// and length delimited fields in bytes.
+type field struct {
+	num      int
+	wireType int
+	varint   uint64
+	bytes    []byte
+}
+
+// varints appends the field's value to vs, whether it is
+// a single varint or packed varints.
+func (f field) varints(vs []uint64) ([]uint64, error) {
+	if f.wireType == 0 {
+		return append(vs, f.varint), nil
+	}
+	b := f.bytes
+	for len(b) > 0 {
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return vs, errors.New("bad packed varint")
+		}
+		vs = append(vs, v)
+		b = b[n:]
+	}
+	return vs, nil
+}
+
+// eachField calls fn with each field of the protocol buffer message in b.
+func eachField(b []byte, fn func(field) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("bad field key")
+		}
+		b = b[n:]
+		f := field{num: int(key >> 3), wireType: int(key & 7)}
+		switch f.wireType {
+		case 0:
+			f.varint, n = binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("bad varint")
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return io.ErrUnexpectedEOF
+			}
+			f.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return errors.New("bad length")
+			}
+			f.bytes = b[n : n+int(l)]
+			b = b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return io.ErrUnexpectedEOF
+			}
+			f.varint = uint64(binary.LittleEndian.Uint32(b))
+			b = b[4:]
+		default:
+			return fmt.Errorf("unsupported wire type %d", f.wireType)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unzigzag decodes a sint64.
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
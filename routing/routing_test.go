@@ -0,0 +1,298 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package routing
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// pb builds protocol buffer messages for tests.
+type pb struct{ bytes.Buffer }
+
+func (p *pb) key(num, wireType int) {
+	p.uvarint(uint64(num<<3 | wireType))
+}
+
+func (p *pb) uvarint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	p.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (p *pb) varint(num int, v uint64) *pb {
+	p.key(num, 0)
+	p.uvarint(v)
+	return p
+}
+
+func (p *pb) bytes(num int, b []byte) *pb {
+	p.key(num, 2)
+	p.uvarint(uint64(len(b)))
+	p.Write(b)
+	return p
+}
+
+func (p *pb) packed(num int, vs ...uint64) *pb {
+	var q pb
+	for _, v := range vs {
+		q.uvarint(v)
+	}
+	return p.bytes(num, q.Bytes())
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+// deltas zigzag encodes the differences between each of vs.
+func deltas(vs ...int64) []uint64 {
+	var prev int64
+	var out []uint64
+	for _, v := range vs {
+		out = append(out, zigzag(v-prev))
+		prev = v
+	}
+	return out
+}
+
+// blob writes a blob of type typ holding data to w, compressed if zip is true.
+func blob(w *bytes.Buffer, typ string, data []byte, zip bool) {
+	var b pb
+	if zip {
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(data)
+		zw.Close()
+		b.varint(2, uint64(len(data))).bytes(3, z.Bytes())
+	} else {
+		b.bytes(1, data)
+	}
+	var h pb
+	h.bytes(1, []byte(typ)).varint(3, uint64(b.Len()))
+	binary.Write(w, binary.BigEndian, uint32(h.Len()))
+	w.Write(h.Bytes())
+	w.Write(b.Bytes())
+}
+
+// testPBF returns an OSM PBF file with a dense node block, a block
+// with a plain node and ways, and an ignored blob in between.
+func testPBF() []byte {
+	var file bytes.Buffer
+	var header pb
+	header.bytes(4, []byte("OsmSchema-V0.6")).bytes(4, []byte("DenseNodes"))
+	blob(&file, "OSMHeader", header.Bytes(), false)
+
+	strs := [][]byte{nil, []byte("ele"), []byte("100"), []byte("highway"), []byte("path"), []byte("name"), []byte("Top")}
+	var st pb
+	for _, s := range strs {
+		st.bytes(1, s)
+	}
+
+	// nodes 1, 2 and 3 with granularity 100 and an offset
+	var dense pb
+	dense.packed(1, deltas(1, 2, 3)...).
+		packed(8, deltas(545000000, 545010000, 545020000)...).
+		packed(9, deltas(-30000000, -30000000, -30000000)...).
+		packed(10, 1, 2, 0, 0, 5, 6, 1, 2, 0)
+	var group1 pb
+	group1.bytes(2, dense.Bytes())
+	var block1 pb
+	block1.bytes(1, st.Bytes()).bytes(2, group1.Bytes()).
+		varint(17, 100).varint(19, 1000000000).varint(20, 0)
+	blob(&file, "OSMData", block1.Bytes(), true)
+
+	blob(&file, "OSMIndex", []byte("ignore me"), false)
+
+	var node pb
+	node.varint(1, zigzag(4)).packed(2, 5).packed(3, 6).
+		varint(8, zigzag(545030000)).varint(9, zigzag(-30000000))
+	var way pb
+	way.varint(1, 10).packed(2, 3).packed(3, 4).packed(8, deltas(1, 2, 3, 4)...)
+	var group2 pb
+	group2.bytes(1, node.Bytes()).bytes(3, way.Bytes())
+	var block2 pb
+	block2.bytes(1, st.Bytes()).bytes(2, group2.Bytes())
+	blob(&file, "OSMData", block2.Bytes(), false)
+
+	return file.Bytes()
+}
+
+func TestScanPBF(t *testing.T) {
+	var nodes []Node
+	var ways []Way
+	err := scanPBF(bytes.NewReader(testPBF()), func(n Node) { nodes = append(nodes, n) }, func(w Way) { ways = append(ways, w) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 4 {
+		t.Fatalf("got %d nodes; wanted 4: %+v", len(nodes), nodes)
+	}
+	for i, want := range []Node{
+		{ID: 1, Lat: 55.5, Long: -3, Tags: map[string]string{"ele": "100"}},
+		{ID: 2, Lat: 55.501, Long: -3},
+		{ID: 3, Lat: 55.502, Long: -3, Tags: map[string]string{"name": "Top", "ele": "100"}},
+		{ID: 4, Lat: 54.503, Long: -3, Tags: map[string]string{"name": "Top"}},
+	} {
+		n := nodes[i]
+		if n.ID != want.ID || math.Abs(n.Lat-want.Lat) > 1e-9 || math.Abs(n.Long-want.Long) > 1e-9 || !reflect.DeepEqual(n.Tags, want.Tags) {
+			t.Errorf("node %d = %+v; wanted %+v", i, n, want)
+		}
+	}
+	want := []Way{{ID: 10, Refs: []int64{1, 2, 3, 4}, Tags: map[string]string{"highway": "path"}}}
+	if !reflect.DeepEqual(ways, want) {
+		t.Errorf("ways = %+v; wanted %+v", ways, want)
+	}
+
+	var bad pb
+	bad.bytes(4, []byte("HistoricalInformation"))
+	var file bytes.Buffer
+	blob(&file, "OSMHeader", bad.Bytes(), false)
+	if err := scanPBF(&file, nil, nil); err == nil {
+		t.Error("read a file needing an unsupported feature")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fname := filepath.Join(t.TempDir(), "test.osm.pbf")
+	if err := ioutil.WriteFile(fname, testPBF(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	g, err := Load(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Len() != 4 {
+		t.Errorf("graph has %d nodes; wanted 4", g.Len())
+	}
+	r, ok := g.Route(geodesy.Point{Lat: 55.5, Long: -3}, geodesy.Point{Lat: 55.502, Long: -3}, 10000)
+	if !ok || math.Abs(r.Distance-geodesy.Haversine(geodesy.Point{Lat: 55.5, Long: -3}, geodesy.Point{Lat: 55.502, Long: -3})) > 1e-6 {
+		t.Errorf("Route = %+v, %v; wanted about 222 m", r, ok)
+	}
+}
+
+// a grid of nodes 0.01° apart, with a path round three sides of a square
+// climbing a hill, and a road across the fourth which can't be walked on.
+var (
+	square = []Node{
+		{ID: 1, Lat: 54.50, Long: -3.00, Tags: map[string]string{"ele": "100"}},
+		{ID: 2, Lat: 54.51, Long: -3.00, Tags: map[string]string{"ele": "400"}},
+		{ID: 3, Lat: 54.51, Long: -2.99},
+		{ID: 4, Lat: 54.50, Long: -2.99, Tags: map[string]string{"ele": "150"}},
+		// on its own
+		{ID: 5, Lat: 54.60, Long: -2.90},
+	}
+	squareWays = []Way{
+		{ID: 1, Refs: []int64{1, 2, 3, 4}, Tags: map[string]string{"highway": "footway"}},
+		{ID: 2, Refs: []int64{1, 4}, Tags: map[string]string{"highway": "motorway"}},
+		{ID: 3, Refs: []int64{5, 99}, Tags: map[string]string{"highway": "path", "access": "private"}},
+	}
+)
+
+func TestRoutes(t *testing.T) {
+	g := New(square, squareWays)
+	pt := func(i int) geodesy.Point { return geodesy.Point{Lat: square[i].Lat, Long: square[i].Long} }
+	side := geodesy.Haversine(pt(0), pt(1))
+	across := geodesy.Haversine(pt(1), pt(2))
+
+	routes, ok := g.Routes(pt(0), []geodesy.Point{pt(3), pt(1), pt(4), {Lat: 54.5, Long: -3.0001}}, 10000)
+	if !ok[0] || math.Abs(routes[0].Distance-(2*side+across)) > 1e-6 {
+		t.Errorf("route round the square = %+v, %v; wanted %f m", routes[0], ok[0], 2*side+across)
+	}
+	if routes[0].Ascent != 300 {
+		t.Errorf("ascent round the square = %f; wanted 300", routes[0].Ascent)
+	}
+	if !ok[1] || math.Abs(routes[1].Distance-side) > 1e-6 {
+		t.Errorf("route up one side = %+v, %v; wanted %f m", routes[1], ok[1], side)
+	}
+	if ok[2] {
+		t.Errorf("found route to an unconnected node: %+v", routes[2])
+	}
+	// a point just off the path is walked to from the nearest node
+	if !ok[3] || routes[3].Distance > 10 {
+		t.Errorf("route to a point just off the path = %+v, %v", routes[3], ok[3])
+	}
+
+	back, _ := g.Route(pt(3), pt(0), 10000)
+	if back.Ascent != 250 {
+		t.Errorf("ascent back round the square = %f; wanted 250", back.Ascent)
+	}
+	if _, ok := g.Route(pt(0), pt(3), side); ok {
+		t.Error("found a route longer than maxDistance")
+	}
+}
+
+func TestNaismith(t *testing.T) {
+	r := Route{Distance: 10000, Ascent: 600}
+	if got := r.Time(); got != 3*time.Hour {
+		t.Errorf("10 km with 600 m of ascent takes %v; wanted 3h", got)
+	}
+}
+
+func TestWalkable(t *testing.T) {
+	for _, tt := range []struct {
+		tags map[string]string
+		want bool
+	}{
+		{map[string]string{"highway": "footway"}, true},
+		{map[string]string{"highway": "motorway"}, false},
+		{map[string]string{"highway": "primary", "foot": "no"}, false},
+		{map[string]string{"highway": "track", "access": "private"}, false},
+		{map[string]string{"highway": "track", "access": "no", "foot": "permissive"}, true},
+		{map[string]string{"waterway": "river"}, false},
+	} {
+		if got := Walkable(tt.tags); got != tt.want {
+			t.Errorf("Walkable(%v) = %v; wanted %v", tt.tags, got, tt.want)
+		}
+	}
+}
+
+func TestNearest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	var nodes []Node
+	var ways []Way
+	for _, lat := range []float64{54.5, 70} {
+		for i := 0; i < 500; i++ {
+			id := int64(len(nodes) + 1)
+			nodes = append(nodes, Node{ID: id, Lat: lat + r.Float64()*0.2, Long: -3 + r.Float64()*0.2})
+			// every other node is on a path
+			if i%2 == 1 {
+				ways = append(ways, Way{ID: id, Refs: []int64{id - 1, id}, Tags: map[string]string{"highway": "path"}})
+			}
+		}
+	}
+	g := New(nodes, ways)
+
+	for i := 0; i < 500; i++ {
+		lat := 54.5 + r.Float64()*0.3 - 0.05
+		if i%2 == 0 {
+			lat += 15.5
+		}
+		p := geodesy.Point{Lat: lat, Long: -3.05 + r.Float64()*0.3}
+		// every node with edges
+		want, wantD := -1, float64(maxSnap)
+		for j := range g.lat {
+			if len(g.edges[j]) == 0 {
+				continue
+			}
+			if d := geodesy.Haversine(p, g.point(j)); d < wantD {
+				want, wantD = j, d
+			}
+		}
+		if got, d := g.nearest(p); got != want || d != wantD {
+			t.Fatalf("nearest(%v) = %d at %f m; wanted %d at %f m", p, got, d, want, wantD)
+		}
+	}
+}
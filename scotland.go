@@ -1,38 +1,49 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
-	"io/ioutil"
+	"fmt"
 	"log"
-	"net/http"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/the42/cartconvert/cartconvert/osgb36"
 )
 
 // jsonToMarkers takes json input and returns all the location infos with a location.
+// Places whose latitude or longitude isn't a number are left out,
+// and printed to stderr, rather than losing the rest of the list.
 func jsonToMarkers(jsons []byte) (Markers, error) {
 	var out struct{ Data []hostelJSONPlace }
-	err := json.Unmarshal(jsons, &out)
 	var hostels Markers
+	if err := json.Unmarshal(jsons, &out); err != nil {
+		return hostels, err
+	}
 	for _, p := range out.Data {
-		var lat, long float64
 		if p.Lat == "" || p.Lng == "" {
 			continue
 		}
-		lat, err = strconv.ParseFloat(p.Lat, 64)
-		long, _ = strconv.ParseFloat(p.Lng, 64)
+		lat, err := strconv.ParseFloat(p.Lat, 64)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "skipping %s: latitude: %v\n", p.Name, err)
+			continue
+		}
+		long, err := strconv.ParseFloat(p.Lng, 64)
 		if err != nil {
-			return hostels, err
+			fmt.Fprintf(os.Stderr, "skipping %s: longitude: %v\n", p.Name, err)
+			continue
 		}
 		hostels.Markers = append(hostels.Markers, Marker{
-			Name: p.Name,
-			Lat:  lat,
-			Long: long,
+			Name:    p.Name,
+			Lat:     lat,
+			Long:    long,
+			Country: "Scotland",
 		})
 	}
-	return hostels, err
+	return hostels, nil
 }
 
 type hostelJSONPlace struct {
@@ -41,15 +52,19 @@ type hostelJSONPlace struct {
 	Lng  string `json:"lng"`
 }
 
-func scottishHostels(jsonURL string) (Markers, error) {
+func scottishHostels(ctx context.Context, f *Fetcher, jsonURL string) (Markers, error) {
 	var hostels Markers
-	f, err := http.Get(jsonURL)
+	bytes, err := f.Get(ctx, jsonURL)
 	if err != nil {
 		return hostels, err
 	}
-	defer f.Body.Close()
-	bytes, _ := ioutil.ReadAll(f.Body)
 	hostels, err = jsonToMarkers(bytes)
+	hostels.Source = jsonURL
+	hostels.Fetched = time.Now()
+	for i := range hostels.Markers {
+		hostels.Markers[i].Kind = KindHostel
+		hostels.Markers[i].Source = jsonURL
+	}
 	return hostels, err
 }
 
@@ -62,26 +77,32 @@ func osGridToMarker(name, osGrid string) (Marker, error) {
 	}
 	latlong := osgb36.OSGB36ToWGS84LatLong(coord)
 	return Marker{
-		Name:  name,
-		Lat:   latlong.Latitude,
-		Long:  latlong.Longitude,
-		scale: 0.8,
+		Name:    name,
+		Lat:     latlong.Latitude,
+		Long:    latlong.Longitude,
+		Country: "Scotland",
+		scale:   0.8,
 	}, nil
 }
 
-func wikiScotlandParse() (Markers, error) {
+// wikiScotlandParse reads the waterfalls from the tables in the
+// list of waterfalls of Scotland at listURL.
+func wikiScotlandParse(ctx context.Context, f *Fetcher, listURL string) (Markers, error) {
 	var waterfalls Markers
 
 	// download list
-	lines, err := GetWikiText("https://en.wikipedia.org/wiki/List_of_waterfalls_of_Scotland")
+	lines, err := GetWikiText(ctx, f, listURL)
 	if err != nil {
 		return waterfalls, err
 	}
 
+	waterfalls.Source = listURL
+	waterfalls.Fetched = time.Now()
+
 	// parse lines of list
 	var inLocation bool = false
 	var lineInLoc int = 0
-	var name, gridref string
+	var name, page, river, gridref string
 	for _, line := range lines {
 		if line == "" {
 			inLocation = false
@@ -98,29 +119,42 @@ func wikiScotlandParse() (Markers, error) {
 		if inLocation {
 			lineInLoc++
 			if lineInLoc == 1 {
-				name, err = ParseXWikiLinks(line)
+				page, err = ParseXWikiLinks(line)
 				if err != nil {
 					// if the name isn't made into a link
 					// get rid of the first "|" and remove any whitespace
+					page = ""
 					name = line[1:]
 					name = strings.TrimSpace(name)
+				} else {
+					name = page
 				}
 				name = strings.ReplaceAll(name, "_", " ")
 			}
+			if lineInLoc == 2 {
+				river = plainWikiText(line[1:])
+			}
 			if lineInLoc == 3 {
 				idx := strings.Index(line, "{{gbm4ibx|")
-				if idx == -1 {
-					log.Printf("%s: no loc found\n%s", name, line)
-				}
 				endidx := strings.Index(line, "}}")
-				if idx == -1 {
-					log.Printf("%s: no end of loc found\n%s", name, line)
+				if idx == -1 || endidx < idx {
+					log.Printf("%s: no loc found\n%s", name, line)
+					inLocation = false
+					continue
 				}
 				gridref = line[idx+10 : endidx]
 				mark, err := osGridToMarker(name, gridref)
 				if err != nil {
-					log.Println("error parsing grid reference")
-					log.Panic(err)
+					return waterfalls, fmt.Errorf("%s: grid reference %q: %v", name, gridref, err)
+				}
+				mark.Kind = KindWaterfall
+				mark.Source = listURL
+				if page != "" {
+					mark.URL = MakeWikiURL(page)
+				}
+				mark.Attrs = map[string]string{"gridref": gridref}
+				if river != "" {
+					mark.Attrs["river"] = river
 				}
 				waterfalls.Markers = append(waterfalls.Markers, mark)
 				inLocation = false
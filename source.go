@@ -0,0 +1,244 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Source is somewhere Markers are loaded from.
+type Source interface {
+	// Name describes the Source, for messages.
+	Name() string
+	// Kind is the Kind of the Markers the Source has.
+	Kind() Kind
+	// Fetch loads the Markers.
+	Fetch(ctx context.Context) (Markers, error)
+}
+
+// SourceConfig says which Source to use and how to set it up.
+// Each type of Source uses only the fields it needs.
+type SourceConfig struct {
+	// Type is the name the Source is registered with.
+	Type string `json:"type"`
+	// Dataset is the set of Markers the Source's Markers go in:
+	// hostels, waterfalls, scotlands or scothostels.
+	Dataset string `json:"dataset,omitempty"`
+	URL     string `json:"url,omitempty"`
+	File    string `json:"file,omitempty"`
+	// Folders are the KML folders to read; if there are none, all are read.
+	Folders []string `json:"folders,omitempty"`
+	// Country is given to the Markers which don't have one.
+	Country string `json:"country,omitempty"`
+	// Workers is how many web pages are crawled at once.
+	// It is set by the -workers flag.
+	Workers int `json:"-"`
+	// Fetcher gets web pages, spacing out the requests to each host
+	// as set by the -rate flag. Web Sources need one.
+	Fetcher *Fetcher `json:"-"`
+}
+
+// fetcher returns the Fetcher a web Source should use.
+func (cfg SourceConfig) fetcher() (*Fetcher, error) {
+	if cfg.Fetcher == nil {
+		return nil, fmt.Errorf("%s source needs a Fetcher", cfg.Type)
+	}
+	return cfg.Fetcher, nil
+}
+
+// datasetKinds are the Kinds of Marker in each dataset.
+var datasetKinds = map[string]Kind{
+	"hostels":     KindHostel,
+	"waterfalls":  KindWaterfall,
+	"scotlands":   KindWaterfall,
+	"scothostels": KindHostel,
+}
+
+// sourceTypes are the registered types of Source, by name.
+var sourceTypes = make(map[string]func(SourceConfig) (Source, error))
+
+// RegisterSource makes a type of Source available to NewSource.
+// It panics if the name is already used.
+func RegisterSource(name string, newSource func(SourceConfig) (Source, error)) {
+	if _, ok := sourceTypes[name]; ok {
+		panic("source type " + name + " registered twice")
+	}
+	sourceTypes[name] = newSource
+}
+
+// NewSource returns a Source of the registered type cfg.Type.
+func NewSource(cfg SourceConfig) (Source, error) {
+	newSource, ok := sourceTypes[cfg.Type]
+	if !ok {
+		var names []string
+		for name := range sourceTypes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown source type %q (want one of %s)", cfg.Type, strings.Join(names, ", "))
+	}
+	return newSource(cfg)
+}
+
+// fetchSource fetches the Markers from src, giving them country
+// if they haven't got a Country.
+func fetchSource(ctx context.Context, src Source, country string) (Markers, error) {
+	if err := ctx.Err(); err != nil {
+		return Markers{}, err
+	}
+	m, err := src.Fetch(ctx)
+	if err != nil {
+		return m, err
+	}
+	if country != "" {
+		for i := range m.Markers {
+			if m.Markers[i].Country == "" {
+				m.Markers[i].Country = country
+			}
+		}
+	}
+	return m, nil
+}
+
+// add appends the Markers in o to m. m keeps its Source, or takes
+// that of o if it has none, and is Fetched when the latest of them was.
+func (m *Markers) add(o Markers) {
+	m.Markers = append(m.Markers, o.Markers...)
+	if m.Source == "" {
+		m.Source = o.Source
+	}
+	if o.Fetched.After(m.Fetched) {
+		m.Fetched = o.Fetched
+	}
+}
+
+func init() {
+	RegisterSource("kml", func(cfg SourceConfig) (Source, error) {
+		if cfg.File == "" {
+			return nil, fmt.Errorf("kml source needs a file")
+		}
+		return kmlSource{file: cfg.File, folders: cfg.Folders}, nil
+	})
+	RegisterSource("geojson", func(cfg SourceConfig) (Source, error) {
+		if cfg.File == "" {
+			return nil, fmt.Errorf("geojson source needs a file")
+		}
+		kind, ok := datasetKinds[cfg.Dataset]
+		if !ok {
+			return nil, fmt.Errorf("unknown dataset %q", cfg.Dataset)
+		}
+		return geoJSONSource{file: cfg.File, kind: kind}, nil
+	})
+	RegisterSource("wikilist", func(cfg SourceConfig) (Source, error) {
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("wikilist source needs a url")
+		}
+		f, err := cfg.fetcher()
+		if err != nil {
+			return nil, err
+		}
+		workers := cfg.Workers
+		if workers < 1 {
+			workers = 1
+		}
+		return wikiListSource{url: cfg.URL, workers: workers, f: f}, nil
+	})
+	RegisterSource("wikiscotland", func(cfg SourceConfig) (Source, error) {
+		url := cfg.URL
+		if url == "" {
+			url = MakeWikiURL("List_of_waterfalls_of_Scotland")
+		}
+		f, err := cfg.fetcher()
+		if err != nil {
+			return nil, err
+		}
+		return wikiScotlandSource{url: url, f: f}, nil
+	})
+	RegisterSource("visitscotland", func(cfg SourceConfig) (Source, error) {
+		url := cfg.URL
+		if url == "" {
+			url = visitScotlandURL
+		}
+		f, err := cfg.fetcher()
+		if err != nil {
+			return nil, err
+		}
+		return visitScotlandSource{url: url, f: f}, nil
+	})
+}
+
+// kmlSource is hostels in a KML or KMZ file, read by KMLGetLocations.
+type kmlSource struct {
+	file    string
+	folders []string
+}
+
+func (s kmlSource) Name() string { return s.file }
+func (s kmlSource) Kind() Kind   { return KindHostel }
+
+func (s kmlSource) Fetch(ctx context.Context) (Markers, error) {
+	return KMLGetLocations(s.file, s.folders...)
+}
+
+// geoJSONSource is Markers in a GeoJSON file.
+type geoJSONSource struct {
+	file string
+	kind Kind
+}
+
+func (s geoJSONSource) Name() string { return s.file }
+func (s geoJSONSource) Kind() Kind   { return s.kind }
+
+func (s geoJSONSource) Fetch(ctx context.Context) (Markers, error) {
+	return GeoJSONtoMarkers(s.file, s.kind)
+}
+
+// wikiListSource is the waterfalls in a Wikipedia list, found by crawlWiki.
+type wikiListSource struct {
+	url     string
+	workers int
+	f       *Fetcher
+}
+
+func (s wikiListSource) Name() string { return s.url }
+func (s wikiListSource) Kind() Kind   { return KindWaterfall }
+
+func (s wikiListSource) Fetch(ctx context.Context) (Markers, error) {
+	return crawlWiki(ctx, s.f, s.url, s.workers)
+}
+
+// wikiScotlandSource is the waterfalls in the tables of
+// the Wikipedia list of waterfalls of Scotland.
+type wikiScotlandSource struct {
+	url string
+	f   *Fetcher
+}
+
+func (s wikiScotlandSource) Name() string { return s.url }
+func (s wikiScotlandSource) Kind() Kind   { return KindWaterfall }
+
+func (s wikiScotlandSource) Fetch(ctx context.Context) (Markers, error) {
+	return wikiScotlandParse(ctx, s.f, s.url)
+}
+
+// visitScotlandURL is where VisitScotland lists places with hostels.
+const visitScotlandURL = "https://www.visitscotland.com/tms-api/v1/origins?active=1"
+
+// visitScotlandSource is the hostels in VisitScotland's JSON.
+type visitScotlandSource struct {
+	url string
+	f   *Fetcher
+}
+
+func (s visitScotlandSource) Name() string { return s.url }
+func (s visitScotlandSource) Kind() Kind   { return KindHostel }
+
+func (s visitScotlandSource) Fetch(ctx context.Context) (Markers, error) {
+	return scottishHostels(ctx, s.f, s.url)
+}
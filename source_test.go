@@ -0,0 +1,118 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedSource is a Source which always has the same Markers.
+type fixedSource struct{ m Markers }
+
+func (s fixedSource) Name() string { return "fixed" }
+func (s fixedSource) Kind() Kind   { return KindWaterfall }
+func (s fixedSource) Fetch(ctx context.Context) (Markers, error) {
+	return s.m, nil
+}
+
+func TestSourceRegistry(t *testing.T) {
+	fetched := time.Date(2021, 3, 12, 6, 7, 0, 0, time.UTC)
+	RegisterSource("test", func(cfg SourceConfig) (Source, error) {
+		return fixedSource{Markers{Source: cfg.URL, Fetched: fetched, Markers: []Marker{
+			{Name: "Glenashdale Falls", Lat: 55.5, Long: -5.1},
+			{Name: "Eas Mor", Lat: 55.4, Long: -5.2, Country: "Arran"},
+		}}}, nil
+	})
+	defer delete(sourceTypes, "test")
+
+	src, err := NewSource(SourceConfig{Type: "test", URL: "test://falls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := fetchSource(context.Background(), src, "Scotland")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Markers[0].Country != "Scotland" || m.Markers[1].Country != "Arran" {
+		t.Errorf("countries = %q, %q; wanted Scotland, Arran", m.Markers[0].Country, m.Markers[1].Country)
+	}
+
+	var all Markers
+	all.add(m)
+	all.add(Markers{Source: "other", Markers: []Marker{{Name: "Achness Falls"}}})
+	if len(all.Markers) != 3 || all.Source != "test://falls" || !all.Fetched.Equal(fetched) {
+		t.Errorf("added Markers = %+v", all)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fetchSource(ctx, src, ""); err == nil {
+		t.Error("fetched with a cancelled context")
+	}
+
+	if _, err := NewSource(SourceConfig{Type: "nonsense"}); err == nil || !strings.Contains(err.Error(), "kml") {
+		t.Errorf("NewSource(nonsense) = %v; wanted an error listing the types", err)
+	}
+	if _, err := NewSource(SourceConfig{Type: "wikilist", URL: "https://example.com"}); err == nil {
+		t.Error("made a wikilist source without a Fetcher")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("registered a source type twice")
+		}
+	}()
+	RegisterSource("kml", nil)
+}
+
+func TestFileSources(t *testing.T) {
+	src, err := NewSource(SourceConfig{Type: "kml", Dataset: "hostels", File: "hostels.xml", Folders: []string{yhaFolder}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostels, err := src.Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hostels.Markers) == 0 {
+		t.Fatal("no YHA hostels")
+	}
+	// the placemarks only link to citations in their descriptions,
+	// which aren't the hostels' own pages
+	urls := make(map[string]string)
+	for _, h := range hostels.Markers {
+		if h.URL == "" {
+			continue
+		}
+		if other, ok := urls[h.URL]; ok {
+			t.Errorf("%s and %s have the same URL %s", other, h.Name, h.URL)
+		}
+		urls[h.URL] = h.Name
+	}
+
+	fname := filepath.Join(t.TempDir(), "falls.geojson")
+	if err := (Markers{Markers: []Marker{{Name: "Aira Force", Lat: 54.5753, Long: -2.9309}}}).SaveGeoJSON(fname); err != nil {
+		t.Fatal(err)
+	}
+	src, err = NewSource(SourceConfig{Type: "geojson", Dataset: "scotlands", File: fname})
+	if err != nil {
+		t.Fatal(err)
+	}
+	falls, err := src.Fetch(context.Background())
+	if err != nil || len(falls.Markers) != 1 || falls.Markers[0].Kind != KindWaterfall || src.Kind() != KindWaterfall {
+		t.Errorf("GeoJSON waterfalls = %+v, %v", falls, err)
+	}
+
+	if _, err := NewSource(SourceConfig{Type: "geojson", Dataset: "castles", File: fname}); err == nil {
+		t.Error("made a source for an unknown dataset")
+	}
+	if _, err := NewSource(SourceConfig{Type: "kml", Dataset: "hostels"}); err == nil {
+		t.Error("made a KML source without a file")
+	}
+}
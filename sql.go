@@ -0,0 +1,135 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Table names used to store each set of Markers in the SQL database.
+const (
+	hostelsTable     = "hostels"
+	waterfallsTable  = "waterfalls"
+	scotlandsTable   = "scotlands"
+	scotHostelsTable = "scot_hostels"
+)
+
+// openSQL opens a SQL database using the named driver.
+// For "sqlite3", dbname is the filename of the database and
+// uname and pwd are ignored; for "mysql", the database is on localhost.
+// The MySQL driver is only available when built with the mysql build tag.
+func openSQL(driver, uname, pwd, dbname string) (*sql.DB, error) {
+	var dsn string
+	switch driver {
+	case "sqlite3":
+		dsn = dbname
+	case "mysql":
+		dsn = fmt.Sprintf("%s:%s@/%s", uname, pwd, dbname)
+	default:
+		return nil, fmt.Errorf("unknown SQL driver %q", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// SaveSQL saves a Markers to the table in db,
+// replacing the table if it already exists.
+// The Markers are written to a new table first, which only replaces
+// the old one once it is full, so a failed save leaves the old table.
+// The number of rows written and an error is returned.
+func (m Markers) SaveSQL(db *sql.DB, table string) (int, error) {
+	// the table is only a cache, so it is simplest to start afresh each time.
+	// MySQL commits DDL statements implicitly, so they are kept out of the transaction.
+	staging := table + "_new"
+	if _, err := db.Exec("DROP TABLE IF EXISTS " + staging); err != nil {
+		return 0, err
+	}
+	// idx keeps the rows in the same order as m.Markers.
+	_, err := db.Exec("CREATE TABLE " + staging + " (idx INTEGER NOT NULL, name TEXT NOT NULL, lat DOUBLE NOT NULL, lng DOUBLE NOT NULL, " +
+		"kind TEXT NOT NULL, country TEXT NOT NULL, url TEXT NOT NULL, source TEXT NOT NULL, attrs TEXT NOT NULL)")
+	if err != nil {
+		return 0, err
+	}
+	n, err := m.insertSQL(db, staging)
+	if err != nil {
+		db.Exec("DROP TABLE " + staging)
+		return n, err
+	}
+
+	// SQLite does this atomically; MySQL commits after each statement,
+	// but there is nothing left which can fail part way through.
+	tx, err := db.Begin()
+	if err != nil {
+		return n, err
+	}
+	if _, err := tx.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+		tx.Rollback()
+		return n, err
+	}
+	if _, err := tx.Exec("ALTER TABLE " + staging + " RENAME TO " + table); err != nil {
+		tx.Rollback()
+		return n, err
+	}
+	return n, tx.Commit()
+}
+
+// insertSQL inserts the Markers into table in one transaction.
+func (m Markers) insertSQL(db *sql.DB, table string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := tx.Prepare("INSERT INTO " + table + " (idx, name, lat, lng, kind, country, url, source, attrs) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	defer stmt.Close()
+	for i, mark := range m.Markers {
+		attrs, err := encodeAttrs(mark.Attrs)
+		if err == nil {
+			_, err = stmt.Exec(i, mark.Name, mark.Lat, mark.Long, string(mark.Kind), mark.Country, mark.URL, mark.Source, attrs)
+		}
+		if err != nil {
+			tx.Rollback()
+			return i, err
+		}
+	}
+	return len(m.Markers), tx.Commit()
+}
+
+// SQLtoMarkers reads the Markers saved by Markers.SaveSQL in table.
+func SQLtoMarkers(db *sql.DB, table string) (Markers, error) {
+	var m Markers
+	rows, err := db.Query("SELECT name, lat, lng, kind, country, url, source, attrs FROM " + table + " ORDER BY idx")
+	if err != nil {
+		return m, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var mark Marker
+		var kind, attrs string
+		if err := rows.Scan(&mark.Name, &mark.Lat, &mark.Long, &kind, &mark.Country, &mark.URL, &mark.Source, &attrs); err != nil {
+			return m, err
+		}
+		mark.Kind = Kind(kind)
+		if mark.Attrs, err = decodeAttrs(attrs); err != nil {
+			return m, err
+		}
+		m.Markers = append(m.Markers, mark)
+	}
+	return m, rows.Err()
+}
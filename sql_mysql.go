@@ -0,0 +1,12 @@
+//go:build mysql
+// +build mysql
+
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+// The MySQL driver is optional; build with -tags mysql to use -sqldriver mysql.
+import _ "github.com/go-sql-driver/mysql"
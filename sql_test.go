@@ -0,0 +1,72 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSQLRoundTrip(t *testing.T) {
+	db, err := openSQL("sqlite3", "", "", filepath.Join(t.TempDir(), "cache.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	m := Markers{
+		Markers: []Marker{{
+			Name:    "Aira Force",
+			Lat:     54.576303,
+			Long:    -2.930905,
+			Kind:    KindWaterfall,
+			Country: "England",
+			URL:     "https://en.wikipedia.org/wiki/Aira_Force",
+			Source:  "https://en.wikipedia.org/wiki/List_of_waterfalls_of_the_United_Kingdom",
+			Attrs:   map[string]string{"height": "22 m", "river": "Aira Beck"},
+		}, {
+			Name: "Janet's Foss",
+			Lat:  54.06,
+			Long: -2.13,
+		}},
+	}
+	// save twice to check that the table is replaced rather than appended to
+	for i := 0; i < 2; i++ {
+		n, err := m.SaveSQL(db, waterfallsTable)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(m.Markers) {
+			t.Errorf("SaveSQL wrote %d rows; wanted %d", n, len(m.Markers))
+		}
+	}
+
+	got, err := SQLtoMarkers(db, waterfallsTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Markers) != len(m.Markers) {
+		t.Fatalf("SQLtoMarkers read %d markers; wanted %d", len(got.Markers), len(m.Markers))
+	}
+	for i := range m.Markers {
+		if !reflect.DeepEqual(got.Markers[i], m.Markers[i]) {
+			t.Errorf("marker %d = %v; wanted %v", i, got.Markers[i], m.Markers[i])
+		}
+	}
+
+	// SQLite stores NaN as NULL, so this row can't be inserted,
+	// and the table saved before should be left as it was
+	bad := Markers{Markers: []Marker{{Name: "High Force", Lat: 54.65, Long: -2.18}, {Name: "Nowhere", Lat: math.NaN()}}}
+	if _, err := bad.SaveSQL(db, waterfallsTable); err == nil {
+		t.Fatal("saved a marker with no latitude")
+	}
+	got, err = SQLtoMarkers(db, waterfallsTable)
+	if err != nil || len(got.Markers) != len(m.Markers) || got.Markers[0].Name != "Aira Force" {
+		t.Errorf("after a failed save the table has %v, %v; wanted the old markers", got.Markers, err)
+	}
+}
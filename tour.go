@@ -0,0 +1,262 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// tourEpsilon is the smallest improvement in meters the tour optimiser
+// makes, so that rounding errors can't make it go round in circles.
+const tourEpsilon = 1e-6
+
+// orOptMax is the longest run of stops Or-opt tries to move.
+const orOptMax = 3
+
+// Tour is an order to visit some Markers in.
+type Tour struct {
+	// Stops are the Markers in the order to visit them,
+	// including the start and end if they were fixed.
+	Stops []Marker
+	// Legs are the distances in meters between the Stops:
+	// Legs[i] is from Stops[i] to Stops[i+1].
+	Legs []float64
+	// Distance is the total distance in meters between the Stops.
+	Distance float64
+}
+
+// planTour finds a short path visiting every one of stops.
+// If start or end is not nil the path begins or finishes there.
+// The path is seeded by always going to the nearest stop not yet
+// visited, then improved by 2-opt (reversing part of the path) and
+// Or-opt (moving up to orOptMax stops elsewhere) until neither helps.
+// Distances are measured by dist.
+func planTour(stops []Marker, start, end *Marker, dist geodesy.Distance) Tour {
+	points := append([]Marker(nil), stops...)
+	var t tourer
+	if start != nil {
+		points = append(points, *start)
+	}
+	if end != nil {
+		points = append(points, *end)
+	}
+	n := len(points)
+	if n == 0 {
+		return Tour{}
+	}
+	t.d = make([][]float64, n)
+	for i := range points {
+		t.d[i] = make([]float64, n)
+		for j := range points {
+			if i != j {
+				t.d[i][j] = distanceBn(dist, points[i], points[j])
+			}
+		}
+	}
+
+	// the indices of start and end, if they are fixed
+	s, e := -1, -1
+	if start != nil {
+		s = len(stops)
+	}
+	if end != nil {
+		e = n - 1
+	}
+	t.path = t.nearestNeighbour(len(stops), s, e)
+	t.lo, t.hi = 0, len(t.path)-1
+	if s >= 0 {
+		t.lo = 1
+	}
+	if e >= 0 {
+		t.hi--
+	}
+	for t.twoOpt() || t.orOpt() {
+	}
+
+	tour := Tour{}
+	for i, p := range t.path {
+		tour.Stops = append(tour.Stops, points[p])
+		if i > 0 {
+			tour.Legs = append(tour.Legs, t.d[t.path[i-1]][p])
+			tour.Distance += t.d[t.path[i-1]][p]
+		}
+	}
+	return tour
+}
+
+// tourer is the state of planTour. Only path[lo:hi+1] may be changed.
+type tourer struct {
+	d      [][]float64
+	path   []int
+	lo, hi int
+}
+
+// cost is the distance between points a and b,
+// or 0 if either is -1, for beyond the end of the path.
+func (t *tourer) cost(a, b int) float64 {
+	if a < 0 || b < 0 {
+		return 0
+	}
+	return t.d[a][b]
+}
+
+// at returns path[i], or -1 if i is out of range.
+func at(path []int, i int) int {
+	if i < 0 || i >= len(path) {
+		return -1
+	}
+	return path[i]
+}
+
+// nearestNeighbour returns a path through the first n points, from s
+// (if it isn't -1) and ending at e (if it isn't -1), which always goes
+// next to the nearest point not yet visited.
+// Without s, it begins at the point furthest from e, or from point 0,
+// so the path starts at one edge of the points.
+func (t *tourer) nearestNeighbour(n, s, e int) []int {
+	var path []int
+	visited := make([]bool, n)
+	cur := s
+	if cur >= 0 {
+		path = append(path, cur)
+	} else if n > 0 {
+		from := e
+		if from < 0 {
+			from = 0
+		}
+		cur = 0
+		for i := 1; i < n; i++ {
+			if t.d[from][i] > t.d[from][cur] {
+				cur = i
+			}
+		}
+		visited[cur] = true
+		path = append(path, cur)
+	}
+	for {
+		next := -1
+		for i := 0; i < n; i++ {
+			if !visited[i] && (next < 0 || t.d[cur][i] < t.d[cur][next]) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		visited[next] = true
+		path = append(path, next)
+		cur = next
+	}
+	if e >= 0 {
+		path = append(path, e)
+	}
+	return path
+}
+
+// twoOpt reverses the first part of the path it finds which makes
+// the path shorter, and reports whether it found one.
+func (t *tourer) twoOpt() bool {
+	for i := t.lo; i <= t.hi; i++ {
+		for j := i + 1; j <= t.hi; j++ {
+			a, b := at(t.path, i-1), t.path[i]
+			c, d := t.path[j], at(t.path, j+1)
+			delta := t.cost(a, c) + t.cost(b, d) - t.cost(a, b) - t.cost(c, d)
+			if delta < -tourEpsilon {
+				for l, r := i, j; l < r; l, r = l+1, r-1 {
+					t.path[l], t.path[r] = t.path[r], t.path[l]
+				}
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// orOpt moves the first run of up to orOptMax stops it finds which
+// makes the path shorter somewhere else in it, perhaps reversed,
+// and reports whether it found one.
+func (t *tourer) orOpt() bool {
+	for l := 1; l <= orOptMax; l++ {
+		for i := t.lo; i+l-1 <= t.hi; i++ {
+			first, last := t.path[i], t.path[i+l-1]
+			prev, next := at(t.path, i-1), at(t.path, i+l)
+			gain := t.cost(prev, first) + t.cost(last, next) - t.cost(prev, next)
+
+			rest := make([]int, 0, len(t.path)-l)
+			rest = append(rest, t.path[:i]...)
+			rest = append(rest, t.path[i+l:]...)
+			// the run can go between rest[k-1] and rest[k], but not
+			// before a fixed start or after a fixed end
+			minK, maxK := t.lo, len(rest)-(len(t.path)-1-t.hi)
+			for k := minK; k <= maxK; k++ {
+				if k == i {
+					continue
+				}
+				a, b := at(rest, k-1), at(rest, k)
+				forward := t.cost(a, first) + t.cost(last, b) - t.cost(a, b)
+				backward := t.cost(a, last) + t.cost(first, b) - t.cost(a, b)
+				if math.Min(forward, backward)-gain < -tourEpsilon {
+					run := append([]int(nil), t.path[i:i+l]...)
+					if backward < forward {
+						for x, y := 0, len(run)-1; x < y; x, y = x+1, y-1 {
+							run[x], run[y] = run[y], run[x]
+						}
+					}
+					t.path = append(append(append(make([]int, 0, len(t.path)), rest[:k]...), run...), rest[k:]...)
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// selectMarkers returns the Markers in m with the names,
+// ignoring case, or an error naming any which aren't found.
+// The name "all" selects every Marker.
+func selectMarkers(m Markers, names []string) ([]Marker, error) {
+	if len(names) == 1 && names[0] == "all" {
+		return append([]Marker(nil), m.Markers...), nil
+	}
+	var found []Marker
+	var missing []string
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		ok := false
+		for _, mark := range m.Markers {
+			if strings.EqualFold(mark.Name, name) {
+				found = append(found, mark)
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return found, fmt.Errorf("not found: %s", strings.Join(missing, ", "))
+	}
+	return found, nil
+}
+
+// Text returns the Tour as plain text, a line for each stop.
+func (t Tour) Text() string {
+	var b strings.Builder
+	for i, s := range t.Stops {
+		if i == 0 {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, s.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "%d. %s (%.1f km)\n", i+1, s.Name, t.Legs[i-1]/1000)
+	}
+	fmt.Fprintf(&b, "%d stops, %.1f km in total.\n", len(t.Stops), t.Distance/1000)
+	return b.String()
+}
@@ -0,0 +1,97 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+func TestPlanTour(t *testing.T) {
+	// waterfalls along a line of latitude, in a jumbled order
+	var stops []Marker
+	for _, i := range rand.New(rand.NewSource(1)).Perm(10) {
+		stops = append(stops, Marker{Name: fmt.Sprint(i), Lat: 0, Long: float64(i) * 0.01})
+	}
+	west := Marker{Name: "West", Lat: 0, Long: -0.01}
+	east := Marker{Name: "East", Lat: 0, Long: 0.1}
+	step := distanceBn(geodesy.Haversine, west, stops[0]) / math.Abs(stops[0].Long+0.01) * 0.01
+
+	for _, tt := range []struct {
+		name       string
+		start, end *Marker
+		// the Tour's Stops, and how far it is in steps between them
+		want  []string
+		steps float64
+	}{
+		{"free", nil, nil, nil, 9},
+		{"start", &west, nil, []string{"West", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9"}, 10},
+		{"end", nil, &west, []string{"9", "8", "7", "6", "5", "4", "3", "2", "1", "0", "West"}, 10},
+		{"both", &east, &west, []string{"East", "9", "8", "7", "6", "5", "4", "3", "2", "1", "0", "West"}, 11},
+		// going the long way round
+		{"same side", &west, &west, []string{"West", "0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "West"}, 20},
+	} {
+		tour := planTour(stops, tt.start, tt.end, geodesy.Haversine)
+		if math.Abs(tour.Distance-tt.steps*step) > 1e-3 {
+			t.Errorf("%s: distance = %f; wanted %f", tt.name, tour.Distance, tt.steps*step)
+		}
+		n := len(tt.want)
+		if tt.want == nil {
+			n = len(stops)
+		}
+		if len(tour.Stops) != n {
+			t.Errorf("%s: %d stops; wanted %d", tt.name, len(tour.Stops), n)
+			continue
+		}
+		for i, name := range tt.want {
+			if tour.Stops[i].Name != name {
+				t.Errorf("%s: stops = %v; wanted %q", tt.name, tour.Stops, tt.want)
+				break
+			}
+		}
+	}
+
+	if tour := planTour(nil, &west, nil, geodesy.Haversine); len(tour.Stops) != 1 || tour.Distance != 0 {
+		t.Errorf("tour with no stops = %+v", tour)
+	}
+}
+
+func TestPlanTourCircle(t *testing.T) {
+	// the shortest way round points on a circle is round the edge
+	var stops []Marker
+	for _, i := range rand.New(rand.NewSource(2)).Perm(24) {
+		a := float64(i) * 2 * math.Pi / 24
+		stops = append(stops, Marker{Name: fmt.Sprint(i), Lat: 0.1 * math.Sin(a), Long: 0.1 * math.Cos(a)})
+	}
+	hostel := Marker{Name: "Hostel", Lat: 0, Long: 0.1}
+	tour := planTour(stops, &hostel, &hostel, geodesy.Haversine)
+	var want float64
+	for i := range stops {
+		a, b := float64(i)*2*math.Pi/24, float64(i+1)*2*math.Pi/24
+		want += distanceBn(geodesy.Haversine, Marker{Lat: 0.1 * math.Sin(a), Long: 0.1 * math.Cos(a)}, Marker{Lat: 0.1 * math.Sin(b), Long: 0.1 * math.Cos(b)})
+	}
+	if math.Abs(tour.Distance-want) > 1 {
+		t.Errorf("tour round a circle is %f m; wanted %f m", tour.Distance, want)
+	}
+}
+
+func TestSelectMarkers(t *testing.T) {
+	m := Markers{Markers: []Marker{{Name: "High Force"}, {Name: "Low Force"}}}
+	got, err := selectMarkers(m, []string{"low force", " High Force"})
+	if err != nil || len(got) != 2 || got[0].Name != "Low Force" {
+		t.Errorf("selectMarkers = %v, %v", got, err)
+	}
+	if _, err := selectMarkers(m, []string{"Aira Force"}); err == nil {
+		t.Error("selected a missing waterfall")
+	}
+	if got, _ := selectMarkers(m, []string{"all"}); len(got) != 2 {
+		t.Errorf("selected %d of all", len(got))
+	}
+}
@@ -0,0 +1,156 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+)
+
+// Problem is something wrong with a Marker found by validate.
+type Problem string
+
+// The Problems validate looks for.
+const (
+	// ProblemInvalid is a latitude or longitude which is NaN, infinite or out of range.
+	ProblemInvalid Problem = "invalid coordinates"
+	// ProblemZero is a Marker at 0,0, usually from a number which failed to parse.
+	ProblemZero Problem = "zero coordinates"
+	// ProblemSwapped is a Marker outside the region which would be
+	// inside it with its latitude and longitude swapped.
+	ProblemSwapped Problem = "swapped coordinates"
+	// ProblemOutside is a Marker outside the region.
+	ProblemOutside Problem = "outside region"
+	// ProblemDuplicate is a Marker with the same name or URL
+	// as an earlier one close to it.
+	ProblemDuplicate Problem = "duplicate"
+)
+
+// Issue is a Problem with one of a Markers.
+type Issue struct {
+	// Index is where the Marker is in the Markers.
+	Index   int
+	Marker  Marker
+	Problem Problem
+	// Detail says more about the Problem, such as which Marker
+	// this one is a duplicate of.
+	Detail string
+}
+
+// Validation is the result of checking a set of Markers.
+type Validation struct {
+	Name   string
+	Total  int
+	Issues []Issue
+}
+
+// validate checks the Markers in m for bad coordinates, for being
+// outside region (unless it is nil) and for duplicates, which are
+// Markers of the same name or URL within dupDistance meters of each other.
+// Different waterfalls can share coordinates in a list, so Markers with
+// different names at the same place aren't duplicates.
+// If dupDistance is not positive, duplicates aren't looked for.
+// A Marker has at most one Issue: the first of the Problems above
+// which it has.
+func (m Markers) validate(name string, region Region, dupDistance float64) Validation {
+	v := Validation{Name: name, Total: len(m.Markers)}
+	var ok Markers
+	var okIndex []int
+	for i, mark := range m.Markers {
+		issue := Issue{Index: i, Marker: mark}
+		switch {
+		case math.IsNaN(mark.Lat) || math.IsNaN(mark.Long) || math.Abs(mark.Lat) > 90 || math.Abs(mark.Long) > 180:
+			issue.Problem = ProblemInvalid
+		case mark.Lat == 0 && mark.Long == 0:
+			issue.Problem = ProblemZero
+		case region != nil && !region.Contains(mark):
+			issue.Problem = ProblemOutside
+			if region.Contains(Marker{Lat: mark.Long, Long: mark.Lat}) {
+				issue.Problem = ProblemSwapped
+			}
+		default:
+			ok.Markers = append(ok.Markers, mark)
+			okIndex = append(okIndex, i)
+			continue
+		}
+		v.Issues = append(v.Issues, issue)
+	}
+
+	tree := newKDTree(ok, geodesy.Haversine)
+	for j, mark := range ok.Markers {
+		if dupDistance <= 0 {
+			break
+		}
+		for _, n := range tree.withinIndexed(mark, dupDistance) {
+			// only the later of a pair is a duplicate
+			if n.i >= j {
+				continue
+			}
+			if strings.EqualFold(n.Name, mark.Name) || (mark.URL != "" && n.URL == mark.URL) {
+				v.Issues = append(v.Issues, Issue{
+					Index:   okIndex[j],
+					Marker:  mark,
+					Problem: ProblemDuplicate,
+					Detail:  fmt.Sprintf("%.0f m from %s", n.Distance, n.Name),
+				})
+				break
+			}
+		}
+	}
+	sort.SliceStable(v.Issues, func(i, j int) bool { return v.Issues[i].Index < v.Issues[j].Index })
+	return v
+}
+
+// Counts returns how many Issues there are with each Problem.
+func (v Validation) Counts() map[Problem]int {
+	counts := make(map[Problem]int)
+	for _, issue := range v.Issues {
+		counts[issue.Problem]++
+	}
+	return counts
+}
+
+// Summary returns a line with the number of each Problem,
+// followed by a line for each Issue.
+func (v Validation) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %d markers, %d with problems", v.Name, v.Total, len(v.Issues))
+	counts := v.Counts()
+	for _, p := range []Problem{ProblemInvalid, ProblemZero, ProblemSwapped, ProblemOutside, ProblemDuplicate} {
+		if counts[p] > 0 {
+			fmt.Fprintf(&b, "; %d %s", counts[p], p)
+		}
+	}
+	b.WriteString("\n")
+	for _, issue := range v.Issues {
+		fmt.Fprintf(&b, "\t%s (%f, %f): %s", issue.Marker.Name, issue.Marker.Lat, issue.Marker.Long, issue.Problem)
+		if issue.Detail != "" {
+			fmt.Fprintf(&b, ", %s", issue.Detail)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// without returns m without the Markers which have Issues in v,
+// which must be the Validation of m.
+func (m Markers) without(v Validation) Markers {
+	bad := make(map[int]bool, len(v.Issues))
+	for _, issue := range v.Issues {
+		bad[issue.Index] = true
+	}
+	out := Markers{Source: m.Source, Fetched: m.Fetched}
+	for i, mark := range m.Markers {
+		if !bad[i] {
+			out.Markers = append(out.Markers, mark)
+		}
+	}
+	return out
+}
@@ -0,0 +1,73 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	m := Markers{Source: "test", Markers: []Marker{
+		{Name: "High Force", Lat: 54.6503, Long: -2.1856},
+		{Name: "Nowhere", Lat: 0, Long: 0},
+		{Name: "Swapped", Lat: -2.1856, Long: 54.6503},
+		{Name: "Abbotsford", Lat: 49.0504, Long: -122.3045},
+		{Name: "high force", Lat: 54.6504, Long: -2.1857},
+		{Name: "Bad", Lat: math.NaN(), Long: -2},
+		{Name: "Too far north", Lat: 91, Long: -2},
+		// different waterfalls can share coordinates
+		{Name: "Sgwd Gwladus", Lat: 51.75, Long: -3.59},
+		{Name: "Sgwd y Pannwr", Lat: 51.75, Long: -3.59, URL: "https://example.org/pannwr"},
+		{Name: "Pannwr", Lat: 51.7501, Long: -3.59, URL: "https://example.org/pannwr"},
+	}}
+	v := m.validate("test", ukBounds, duplicateDistance)
+	var got []Problem
+	var index []int
+	for _, issue := range v.Issues {
+		got = append(got, issue.Problem)
+		index = append(index, issue.Index)
+	}
+	want := []Problem{ProblemZero, ProblemSwapped, ProblemOutside, ProblemDuplicate, ProblemInvalid, ProblemInvalid, ProblemDuplicate}
+	if !reflect.DeepEqual(got, want) || !reflect.DeepEqual(index, []int{1, 2, 3, 4, 5, 6, 9}) {
+		t.Errorf("problems = %v at %v; wanted %v at 1-6 and 9", got, index, want)
+	}
+	if v.Total != 10 || v.Counts()[ProblemInvalid] != 2 {
+		t.Errorf("validation = %+v", v)
+	}
+	summary := v.Summary()
+	if !strings.HasPrefix(summary, "test: 10 markers, 7 with problems; 2 invalid coordinates; 1 zero coordinates; 1 swapped coordinates; 1 outside region; 2 duplicate\n") ||
+		!strings.Contains(summary, "high force (54.650400, -2.185700): duplicate, 13 m from High Force\n") {
+		t.Errorf("summary is\n%s", summary)
+	}
+
+	good := m.without(v)
+	if len(good.Markers) != 3 || good.Source != "test" || good.Markers[2].Name != "Sgwd y Pannwr" {
+		t.Errorf("without problems = %+v", good)
+	}
+
+	// without a region only the coordinates and duplicates are checked
+	if v := m.validate("test", nil, 0); len(v.Issues) != 3 {
+		t.Errorf("got %d issues without a region or duplicates; wanted 3", len(v.Issues))
+	}
+}
+
+func TestJSONToMarkers(t *testing.T) {
+	m, err := jsonToMarkers([]byte(`{"data": [{"name": "Glencoe", "lat": "56.67", "lng": "-5.07"}, {"name": "Nowhere", "lat": "", "lng": ""}]}`))
+	if err != nil || len(m.Markers) != 1 || m.Markers[0].Long != -5.07 {
+		t.Errorf("jsonToMarkers = %+v, %v", m, err)
+	}
+	// a bad row is skipped, not the end of the list
+	m, err = jsonToMarkers([]byte(`{"data": [{"name": "Glencoe", "lat": "56.67", "lng": "west"}, {"name": "Oban", "lat": "56.41", "lng": "-5.47"}]}`))
+	if err != nil || len(m.Markers) != 1 || m.Markers[0].Name != "Oban" {
+		t.Errorf("jsonToMarkers with a bad longitude = %+v, %v; wanted only Oban", m, err)
+	}
+	if _, err := jsonToMarkers([]byte(`{"data": `)); err == nil {
+		t.Error("bad JSON was ignored")
+	}
+}
@@ -0,0 +1,72 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"math"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+	"github.com/aabacchus/holiday-plan/routing"
+)
+
+// walkCandidates is how many of the nearest nodes in a straight line
+// a walkMatcher considers when matching by walking routes.
+const walkCandidates = 5
+
+// maxWalk is the furthest in meters a walkMatcher will look for a route.
+const maxWalk = 50000
+
+// walkMatcher matches Markers by routes through a walking graph.
+// It is made from the -osm and -metric flags, and given to matchClosest
+// and planItinerary to match by walking instead of in a straight line;
+// a nil *walkMatcher matches in a straight line.
+type walkMatcher struct {
+	g *routing.Graph
+	// byTime is whether to compare routes by the time to walk them,
+	// using Naismith's rule, rather than by their length.
+	// The climb is only known between nodes tagged with their elevation,
+	// and few are in OpenStreetMap, so this is mostly flat walking time.
+	byTime bool
+}
+
+// cost is how far the Route is by the walkMatcher's metric.
+func (w *walkMatcher) cost(r routing.Route) float64 {
+	if w.byTime {
+		return r.Time().Seconds()
+	}
+	return r.Distance
+}
+
+// closestIndex returns the index of the Marker in the tree which is the
+// shortest walk from m, of the walkCandidates nearest in a straight line.
+// If none of them can be walked to, the nearest in a straight line is used.
+func (w *walkMatcher) closestIndex(m Marker, nodes Markers, tree *kdTree) int {
+	candidates := tree.kNearestIndex(m, walkCandidates)
+	if len(candidates) == 0 {
+		return -1
+	}
+	var to []Marker
+	for _, i := range candidates {
+		to = append(to, nodes.Markers[i])
+	}
+	routes, ok := w.routes(m, to)
+	best, bestCost := candidates[0], math.Inf(1)
+	for j, i := range candidates {
+		if ok[j] && w.cost(routes[j]) < bestCost {
+			best, bestCost = i, w.cost(routes[j])
+		}
+	}
+	return best
+}
+
+// routes finds the walks from m to each of to, as routing.Graph.Routes.
+func (w *walkMatcher) routes(m Marker, to []Marker) ([]routing.Route, []bool) {
+	points := make([]geodesy.Point, len(to))
+	for i, t := range to {
+		points[i] = t.point()
+	}
+	return w.g.Routes(m.point(), points, maxWalk)
+}
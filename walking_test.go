@@ -0,0 +1,86 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/aabacchus/holiday-plan/geodesy"
+	"github.com/aabacchus/holiday-plan/routing"
+)
+
+func TestMatchClosestWalking(t *testing.T) {
+	// the waterfall is closest to Near in a straight line,
+	// but the path to it goes a long way round, and Far is on the same path
+	fall := Marker{Name: "Force", Lat: 54.500, Long: -3.000}
+	near := Marker{Name: "Near", Lat: 54.505, Long: -3.000}
+	far := Marker{Name: "Far", Lat: 54.490, Long: -3.000}
+	nodes := []routing.Node{
+		{ID: 1, Lat: fall.Lat, Long: fall.Long},
+		{ID: 2, Lat: 54.500, Long: -3.050},
+		{ID: 3, Lat: near.Lat, Long: -3.050},
+		{ID: 4, Lat: near.Lat, Long: near.Long},
+		{ID: 5, Lat: far.Lat, Long: far.Long},
+	}
+	ways := []routing.Way{
+		{ID: 1, Refs: []int64{1, 2, 3, 4}, Tags: map[string]string{"highway": "path"}},
+		{ID: 2, Refs: []int64{1, 5}, Tags: map[string]string{"highway": "path"}},
+	}
+	hostels := Markers{Markers: []Marker{near, far}}
+	waterfalls := Markers{Markers: []Marker{fall}}
+
+	if m := matchClosest(waterfalls, hostels, geodesy.Haversine, nil); m[0].Node.Name != "Near" {
+		t.Errorf("closest in a straight line = %s; wanted Near", m[0].Node.Name)
+	}
+	g := routing.New(nodes, ways)
+	if m := matchClosest(waterfalls, hostels, geodesy.Haversine, &walkMatcher{g: g}); m[0].Node.Name != "Far" {
+		t.Errorf("closest walk = %s; wanted Far", m[0].Node.Name)
+	}
+	if m := matchClosest(waterfalls, hostels, geodesy.Haversine, &walkMatcher{g: g, byTime: true}); m[0].Node.Name != "Far" {
+		t.Errorf("quickest walk = %s; wanted Far", m[0].Node.Name)
+	}
+}
+
+func TestMatchClosestTime(t *testing.T) {
+	// Up is about 1 km away but 300 m higher, which by Naismith's rule
+	// takes longer than walking the 2 km to Flat
+	fall := Marker{Name: "Force", Lat: 54.500, Long: -3.000}
+	up := Marker{Name: "Up", Lat: 54.509, Long: -3.000}
+	flat := Marker{Name: "Flat", Lat: 54.500, Long: -3.030}
+	nodes := []routing.Node{
+		{ID: 1, Lat: fall.Lat, Long: fall.Long, Tags: map[string]string{"ele": "100"}},
+		{ID: 2, Lat: 54.5045, Long: -3.000, Tags: map[string]string{"ele": "250"}},
+		{ID: 3, Lat: up.Lat, Long: up.Long, Tags: map[string]string{"ele": "400 m"}},
+		{ID: 4, Lat: flat.Lat, Long: flat.Long, Tags: map[string]string{"ele": "100"}},
+	}
+	ways := []routing.Way{
+		{ID: 1, Refs: []int64{1, 2, 3}, Tags: map[string]string{"highway": "path"}},
+		{ID: 2, Refs: []int64{4, 1}, Tags: map[string]string{"highway": "track"}},
+	}
+	hostels := Markers{Markers: []Marker{up, flat}}
+	waterfalls := Markers{Markers: []Marker{fall}}
+
+	g := routing.New(nodes, ways)
+	for _, tt := range []struct {
+		metric string
+		walk   *walkMatcher
+		want   string
+	}{
+		{"straight", nil, "Up"},
+		{"walking", &walkMatcher{g: g}, "Up"},
+		{"time", &walkMatcher{g: g, byTime: true}, "Flat"},
+	} {
+		if m := matchClosest(waterfalls, hostels, geodesy.Haversine, tt.walk); m[0].Node.Name != tt.want {
+			t.Errorf("closest by %s = %s; wanted %s", tt.metric, m[0].Node.Name, tt.want)
+		}
+	}
+
+	// and the other way, the walk down to the waterfall is quicker
+	routes, ok := (&walkMatcher{g: g, byTime: true}).routes(up, []Marker{fall})
+	if !ok[0] || routes[0].Ascent != 0 {
+		t.Errorf("walk down from Up = %+v, %v; wanted no ascent", routes[0], ok[0])
+	}
+}
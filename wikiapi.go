@@ -0,0 +1,181 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// wikiAPIBatch is the most titles the MediaWiki API accepts in one query.
+const wikiAPIBatch = 50
+
+// coordsResponse is the part of the MediaWiki API's response to a
+// prop=coordinates|revisions query (with formatversion=2) which we need.
+type coordsResponse struct {
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		Normalized []titleMapping `json:"normalized"`
+		Redirects  []titleMapping `json:"redirects"`
+		Pages      []struct {
+			Title       string `json:"title"`
+			Missing     bool   `json:"missing"`
+			Coordinates []struct {
+				Lat     float64 `json:"lat"`
+				Lon     float64 `json:"lon"`
+				Primary bool    `json:"primary"`
+			} `json:"coordinates"`
+			Revisions []struct {
+				Slots struct {
+					Main struct {
+						Content string `json:"content"`
+					} `json:"main"`
+				} `json:"slots"`
+			} `json:"revisions"`
+		} `json:"pages"`
+	} `json:"query"`
+	Error *struct {
+		Code string `json:"code"`
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+type titleMapping struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// APICoordinates looks up the primary coordinates of each of the
+// Wikipedia pages using the MediaWiki API at apiURL,
+// asking for up to wikiAPIBatch pages at a time and following redirects.
+// The Markers are returned in the same order as pages,
+// with the pagename as a Name, the page redirected to as a URL
+// and Attrs from the page's infobox, like GetLocationFromWikiPage.
+// The pages which have no coordinates are returned as missing.
+func APICoordinates(ctx context.Context, f *Fetcher, apiURL string, pages []string) (m Markers, missing []string, err error) {
+	found := make(map[string]Marker)
+	for start := 0; start < len(pages); start += wikiAPIBatch {
+		end := start + wikiAPIBatch
+		if end > len(pages) {
+			end = len(pages)
+		}
+		if err := queryCoordinates(ctx, f, apiURL, pages[start:end], found); err != nil {
+			return m, missing, err
+		}
+	}
+
+	for _, p := range pages {
+		mark, ok := found[p]
+		if !ok {
+			missing = append(missing, p)
+			continue
+		}
+		m.Markers = append(m.Markers, mark)
+	}
+	return m, missing, nil
+}
+
+// queryCoordinates makes one prop=coordinates|revisions query for titles,
+// following any continuations, and adds the Markers it finds to found.
+// The wikitext of each page is asked for too, so that the Markers get
+// their infobox Attrs without fetching every page again.
+func queryCoordinates(ctx context.Context, f *Fetcher, apiURL string, titles []string, found map[string]Marker) error {
+	params := url.Values{
+		"action":        {"query"},
+		"prop":          {"coordinates|revisions"},
+		"coprimary":     {"primary"},
+		"rvprop":        {"content"},
+		"rvslots":       {"main"},
+		"colimit":       {"max"},
+		"redirects":     {"1"},
+		"format":        {"json"},
+		"formatversion": {"2"},
+		"titles":        {strings.Join(titles, "|")},
+	}
+
+	// the title of the page each of the requested titles ends up at
+	target := make(map[string]string)
+	// the infobox of each page, which may come in a different
+	// continuation from its coordinates
+	attrs := make(map[string]map[string]string)
+	for {
+		body, err := f.Get(ctx, apiURL+"?"+params.Encode())
+		if err != nil {
+			return err
+		}
+		var r coordsResponse
+		if err := json.Unmarshal(body, &r); err != nil {
+			return err
+		}
+		if r.Error != nil {
+			return errors.New(r.Error.Code + ": " + r.Error.Info)
+		}
+
+		if len(target) == 0 {
+			normalized := make(map[string]string)
+			for _, n := range r.Query.Normalized {
+				normalized[n.From] = n.To
+			}
+			redirects := make(map[string]string)
+			for _, rd := range r.Query.Redirects {
+				redirects[rd.From] = rd.To
+			}
+			for _, t := range titles {
+				to := t
+				if n, ok := normalized[to]; ok {
+					to = n
+				}
+				if rd, ok := redirects[to]; ok {
+					to = rd
+				}
+				target[t] = to
+			}
+		}
+
+		for _, p := range r.Query.Pages {
+			if len(p.Revisions) != 0 {
+				if a := InfoboxAttrs(p.Revisions[0].Slots.Main.Content); a != nil {
+					attrs[p.Title] = a
+				}
+			}
+			if p.Missing || len(p.Coordinates) == 0 {
+				continue
+			}
+			for _, t := range titles {
+				if target[t] != p.Title {
+					continue
+				}
+				if *verbose && t != strings.ReplaceAll(p.Title, " ", "_") {
+					fmt.Fprintf(os.Stderr, "%s :  redirecting to %s\n", t, p.Title)
+				}
+				found[t] = Marker{
+					Name: strings.ReplaceAll(t, "_", " "),
+					Lat:  p.Coordinates[0].Lat,
+					Long: p.Coordinates[0].Lon,
+					URL:  MakeWikiURL(strings.ReplaceAll(p.Title, " ", "_")),
+				}
+			}
+		}
+
+		if len(r.Continue) == 0 {
+			for _, t := range titles {
+				if mark, ok := found[t]; ok && attrs[target[t]] != nil {
+					mark.Attrs = attrs[target[t]]
+					found[t] = mark
+				}
+			}
+			return nil
+		}
+		for k, v := range r.Continue {
+			params.Set(k, v)
+		}
+	}
+}
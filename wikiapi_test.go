@@ -0,0 +1,183 @@
+/* Copyright 2021 Ben Fuller
+ * Apache License, Version 2.0
+ * See LICENCE file for copyright and licence details.
+ */
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// coordsAPI returns a stub of the MediaWiki API which answers
+// prop=coordinates|revisions queries from coords, texts and redirects
+// (keyed by title), returning at most one page's coordinates per response
+// so that continuations are exercised. The wikitext of the pages is
+// all in the first response.
+// The number of titles in each query is appended to batches.
+func coordsAPI(t *testing.T, coords map[string][2]float64, texts, redirects map[string]string, batches *[]int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("prop") != "coordinates|revisions" || q.Get("rvprop") != "content" || q.Get("rvslots") != "main" ||
+			q.Get("redirects") == "" || q.Get("formatversion") != "2" {
+			t.Errorf("unexpected query %s", r.URL.RawQuery)
+		}
+		titles := strings.Split(q.Get("titles"), "|")
+		if len(titles) > wikiAPIBatch {
+			t.Errorf("got %d titles in one query; wanted at most %d", len(titles), wikiAPIBatch)
+		}
+		if q.Get("cocontinue") == "" {
+			*batches = append(*batches, len(titles))
+		}
+
+		var resp struct {
+			Continue map[string]string `json:"continue,omitempty"`
+			Query    struct {
+				Normalized []titleMapping           `json:"normalized,omitempty"`
+				Redirects  []titleMapping           `json:"redirects,omitempty"`
+				Pages      []map[string]interface{} `json:"pages"`
+			} `json:"query"`
+		}
+		skip := 0
+		fmt.Sscan(q.Get("cocontinue"), &skip)
+		withCoords := 0
+		seen := make(map[string]bool)
+		for _, title := range titles {
+			norm := strings.ReplaceAll(title, "_", " ")
+			if norm != title {
+				resp.Query.Normalized = append(resp.Query.Normalized, titleMapping{title, norm})
+			}
+			if to, ok := redirects[norm]; ok {
+				resp.Query.Redirects = append(resp.Query.Redirects, titleMapping{norm, to})
+				norm = to
+			}
+			if seen[norm] {
+				continue
+			}
+			seen[norm] = true
+			page := map[string]interface{}{"ns": 0, "title": norm}
+			if text, ok := texts[norm]; ok && skip == 0 {
+				page["revisions"] = []map[string]interface{}{{"slots": map[string]interface{}{"main": map[string]string{"content": text}}}}
+			}
+			c, ok := coords[norm]
+			switch {
+			case !ok:
+				page["missing"] = true
+			case withCoords < skip:
+				withCoords++
+			case withCoords == skip && resp.Continue == nil:
+				withCoords++
+				page["coordinates"] = []map[string]interface{}{{"lat": c[0], "lon": c[1], "primary": true, "globe": "earth"}}
+				resp.Continue = map[string]string{"cocontinue": fmt.Sprint(withCoords), "continue": "||"}
+			}
+			resp.Query.Pages = append(resp.Query.Pages, page)
+		}
+		if withCoords == skip {
+			resp.Continue = nil
+		}
+		// only the first response of a query has the normalized titles and redirects
+		if skip > 0 {
+			resp.Query.Normalized, resp.Query.Redirects = nil, nil
+		}
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func TestAPICoordinates(t *testing.T) {
+	var batches []int
+	coords := map[string][2]float64{
+		"Aira Force":                {54.5753, -2.9309},
+		"Ingleton Waterfalls Trail": {54.15, -2.4667},
+	}
+	redirects := map[string]string{
+		"Ingleton Falls": "Ingleton Waterfalls Trail",
+		"Pecca Falls":    "Ingleton Waterfalls Trail",
+	}
+	pages := []string{"Aira_Force", "Ingleton_Falls", "Broada_Falls", "Pecca_Falls"}
+	// enough pages to need more than one batch
+	for i := 0; i < wikiAPIBatch; i++ {
+		name := fmt.Sprintf("Force %d", i)
+		coords[name] = [2]float64{50 + float64(i)/100, -3}
+		pages = append(pages, strings.ReplaceAll(name, " ", "_"))
+	}
+	texts := map[string]string{
+		// the coordinates of Ingleton come in a later response than this
+		"Ingleton Waterfalls Trail": "{{Infobox hiking trail\n| name = Ingleton Waterfalls Trail\n| river = [[River Twiss]]\n}}\n",
+		"Force 0":                   "No infobox here.\n",
+	}
+	useWikiServer(t, nil, coordsAPI(t, coords, texts, redirects, &batches))
+
+	got, missing, err := APICoordinates(context.Background(), newFetcher(nil, 0), wikiAPI, pages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || batches[0] != wikiAPIBatch || batches[1] != len(pages)-wikiAPIBatch {
+		t.Errorf("queried batches of %v titles; wanted [%d %d]", batches, wikiAPIBatch, len(pages)-wikiAPIBatch)
+	}
+	if len(missing) != 1 || missing[0] != "Broada_Falls" {
+		t.Errorf("missing = %v; wanted [Broada_Falls]", missing)
+	}
+	if len(got.Markers) != len(pages)-1 {
+		t.Fatalf("got %d markers; wanted %d", len(got.Markers), len(pages)-1)
+	}
+	want := []Marker{
+		{Name: "Aira Force", Lat: 54.5753, Long: -2.9309, URL: wikiPrefix + "Aira_Force"},
+		{Name: "Ingleton Falls", Lat: 54.15, Long: -2.4667, URL: wikiPrefix + "Ingleton_Waterfalls_Trail",
+			Attrs: map[string]string{"river": "River Twiss"}},
+		{Name: "Pecca Falls", Lat: 54.15, Long: -2.4667, URL: wikiPrefix + "Ingleton_Waterfalls_Trail",
+			Attrs: map[string]string{"river": "River Twiss"}},
+		{Name: "Force 0", Lat: 50, Long: -3, URL: wikiPrefix + "Force_0"},
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got.Markers[i], want[i]) {
+			t.Errorf("marker %d = %v; wanted %v", i, got.Markers[i], want[i])
+		}
+	}
+}
+
+func TestCrawlWikiFallback(t *testing.T) {
+	var batches []int
+	useWikiServer(t, map[string]string{
+		"List": "===[[Wales]]===\n" +
+			"*[[Aber Falls]], [[Abergwyngregyn]]\n" +
+			"*[[Conwy Falls]]\n" +
+			"*[[Dolgoch Falls]]\n",
+		"Conwy_Falls": "{{coord|53|3|N|3|44|W|display=title}}\n",
+	}, coordsAPI(t, map[string][2]float64{
+		"Aber Falls":    {53.2219, -3.9958},
+		"Dolgoch Falls": {52.6231, -3.9931},
+	}, map[string]string{
+		"Aber Falls": "{{Infobox waterfall\n| name = Aber Falls\n| height = {{convert|37|m}}\n| watercourse = [[Afon Goch]]\n}}\n",
+	}, nil, &batches))
+
+	got, err := crawlWiki(context.Background(), newFetcher(nil, 0), wikiPrefix+"List", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Marker{
+		// the waterfalls found by the API have their infobox too
+		{Name: "Aber Falls", Lat: 53.2219, Long: -3.9958, URL: wikiPrefix + "Aber_Falls",
+			Attrs: map[string]string{"height": "37 m", "river": "Afon Goch"}},
+		{Name: "Conwy Falls", Lat: 53 + 3.0/60, Long: -3 - 44.0/60, URL: wikiPrefix + "Conwy_Falls"},
+		{Name: "Dolgoch Falls", Lat: 52.6231, Long: -3.9931, URL: wikiPrefix + "Dolgoch_Falls"},
+	}
+	for i := range want {
+		want[i].Kind = KindWaterfall
+		want[i].Country = "Wales"
+		want[i].Source = wikiPrefix + "List"
+	}
+	if len(got.Markers) != len(want) {
+		t.Fatalf("crawlWiki got %v; wanted %v", got.Markers, want)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got.Markers[i], want[i]) {
+			t.Errorf("marker %d = %v; wanted %v", i, got.Markers[i], want[i])
+		}
+	}
+}